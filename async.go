@@ -0,0 +1,132 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrClientClosed is returned by the async calls started after the client is closed
+var ErrClientClosed = errors.New("client is closed")
+
+// AsyncCaller is implemented by clients able to make calls in the background
+type AsyncCaller interface {
+	// CallAsync makes the call in the background, the channel receives its error once it's completed
+	CallAsync(ctx context.Context, request Request, result interface{}) <-chan error
+	// InFlightRequests returns the number of background goroutines of the client, i.e. the async calls
+	// and the pending signatures of the ContextSigner
+	InFlightRequests() int
+	// Close rejects new async calls and waits for the background goroutines to complete
+	Close(ctx context.Context) error
+}
+
+var _ AsyncCaller = apiClient{}
+
+// asyncTracker accounts for the goroutines started by the client
+type asyncTracker struct {
+	mu       sync.Mutex
+	inFlight int
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// start registers the goroutine about to start, it returns false once the tracker is closed
+func (t *asyncTracker) start() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return false
+	}
+	t.inFlight++
+	t.wg.Add(1)
+
+	return true
+}
+
+// done unregisters the completed goroutine
+func (t *asyncTracker) done() {
+	t.mu.Lock()
+	t.inFlight--
+	t.mu.Unlock()
+
+	t.wg.Done()
+}
+
+func (t *asyncTracker) count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.inFlight
+}
+
+// close rejects new goroutines and waits for the started ones as long as the context allows
+func (t *asyncTracker) close(ctx context.Context) error {
+	t.mu.Lock()
+	t.closed = true
+	t.mu.Unlock()
+
+	completed := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(completed)
+	}()
+
+	select {
+	case <-completed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// goTracked runs the function in the tracked goroutine, it returns false if the client is closed
+func (c apiClient) goTracked(fn func()) bool {
+	if c.async == nil {
+		go fn()
+		return true
+	}
+
+	if !c.async.start() {
+		return false
+	}
+
+	go func() {
+		defer c.async.done()
+		fn()
+	}()
+
+	return true
+}
+
+// CallAsync makes the call in the background, the channel receives its error once it's completed
+func (c apiClient) CallAsync(ctx context.Context, request Request, result interface{}) <-chan error {
+	errs := make(chan error, 1)
+
+	started := c.goTracked(func() {
+		errs <- c.CallRequest(ctx, request, result)
+	})
+	if !started {
+		errs <- ErrClientClosed
+	}
+
+	return errs
+}
+
+// InFlightRequests returns the number of background goroutines of the client
+func (c apiClient) InFlightRequests() int {
+	if c.async == nil {
+		return 0
+	}
+
+	return c.async.count()
+}
+
+// Close rejects new async calls and waits for the background goroutines to complete
+func (c apiClient) Close(ctx context.Context) error {
+	if c.async == nil {
+		return nil
+	}
+
+	return c.async.close(ctx)
+}
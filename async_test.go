@@ -0,0 +1,72 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCallAsync_InFlightRequests(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		<-release
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {},"id": "1"}`))
+	}))
+	defer server.Close()
+
+	config := NewConfig("public", "secret")
+	config.BaseURL = server.URL
+	client := New(config).(*apiClient)
+	client.HTTPClient = server.Client()
+
+	const calls = 50
+	results := make([]<-chan error, 0, calls)
+	for i := 0; i < calls; i++ {
+		results = append(results, client.CallAsync(context.Background(), Request{Method: "any.method", ID: "1"}, &struct{}{}))
+	}
+	assert.Equal(t, calls, client.InFlightRequests())
+
+	close(release)
+	for _, errs := range results {
+		assert.NoError(t, <-errs)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, client.Close(ctx))
+	assert.Equal(t, 0, client.InFlightRequests())
+
+	err := <-client.CallAsync(context.Background(), Request{Method: "any.method"}, &struct{}{})
+	assert.True(t, errors.Is(err, ErrClientClosed))
+}
+
+func TestClose_WaitsForInFlightRequests(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		<-release
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {},"id": "1"}`))
+	}))
+	defer server.Close()
+
+	config := NewConfig("public", "secret")
+	config.BaseURL = server.URL
+	client := New(config).(*apiClient)
+	client.HTTPClient = server.Client()
+
+	errs := client.CallAsync(context.Background(), Request{Method: "any.method", ID: "1"}, &struct{}{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, client.Close(ctx))
+	assert.Equal(t, 1, client.InFlightRequests())
+
+	close(release)
+	assert.NoError(t, <-errs)
+	assert.NoError(t, client.Close(context.Background()))
+	assert.Equal(t, 0, client.InFlightRequests())
+}
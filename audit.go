@@ -0,0 +1,66 @@
+package client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// AuditBodyLimit is the maximum number of bytes of the response body given to Config.AuditHook
+const AuditBodyLimit = 64 << 10
+
+// AuditEvent describes the exact bytes sent and received by a single attempt, e.g. for signature audits
+type AuditEvent struct {
+	Method       string
+	Attempt      int
+	RequestBody  []byte // The signed body as it's sent, nil for the batch streamed with Config.StreamBatchBody
+	Signature    string // The signature without the scheme of the Authorization header
+	StatusCode   int    // Zero if the request failed
+	ResponseBody []byte // Up to AuditBodyLimit bytes of the decompressed response body
+	Err          error  // The transport error of the attempt
+}
+
+// audit reports the attempt to Config.AuditHook, the response body is still readable afterwards
+func (c apiClient) audit(req *http.Request, method string, attempt int, resp *http.Response, err error) error {
+	event := AuditEvent{
+		Method:  method,
+		Attempt: attempt,
+		Err:     err,
+	}
+
+	if capturableBody(req) {
+		body, bodyErr := req.GetBody()
+		if bodyErr != nil {
+			return bodyErr
+		}
+		if event.RequestBody, bodyErr = ioutil.ReadAll(body); bodyErr != nil {
+			return bodyErr
+		}
+	}
+
+	signature := req.Header.Get("Authorization")
+	if i := strings.IndexByte(signature, ' '); i >= 0 {
+		signature = signature[i+1:]
+	}
+	event.Signature = signature
+
+	if resp != nil {
+		event.StatusCode = resp.StatusCode
+		peeked, replay, peekErr := peekBody(resp.Body, AuditBodyLimit)
+		if peekErr != nil {
+			return peekErr
+		}
+		resp.Body = replay
+		event.ResponseBody = peeked
+	}
+
+	c.Config.AuditHook(event)
+
+	return nil
+}
+
+// capturableBody tells if the request body can be read once again for the hooks. The streamed batch body
+// isn't, since reading it starts encoding the whole batch again, which races with the body being sent
+func capturableBody(req *http.Request) bool {
+	return req.GetBody != nil && req.ContentLength >= 0
+}
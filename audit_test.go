@@ -0,0 +1,53 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_Call_AuditHook(t *testing.T) {
+	var attempts int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		attempts++
+		if attempts == 1 {
+			rw.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {"status": "ok"},"id": "1"}`))
+	}))
+	defer server.Close()
+
+	var events []AuditEvent
+	config := NewConfig("public", "secret")
+	config.BaseURL = server.URL
+	config.RetryMax = 1
+	config.RetryWaitMin = time.Millisecond
+	config.RetryWaitMax = time.Millisecond
+	config.CanonicalJSON = true
+	config.AuditHook = func(audit AuditEvent) {
+		events = append(events, audit)
+	}
+	client := apiClient{HTTPClient: server.Client(), Config: config}
+
+	var result struct{ Status string }
+	err := client.Call("any.method", map[string]int{"b": 2, "a": 1}, &result)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", result.Status, "the audited response is still decoded")
+	assert.Len(t, events, 2)
+	for i, event := range events {
+		assert.Equal(t, "any.method", event.Method)
+		assert.Equal(t, i+1, event.Attempt)
+		assert.Equal(t, `{"id":"1","jsonrpc":"2.0","method":"any.method","params":{"a":1,"b":2}}`, string(event.RequestBody))
+
+		valid, err := VerifySignature("public", "secret", event.RequestBody, event.Signature)
+		assert.NoError(t, err)
+		assert.True(t, valid, "the audited bytes are the signed ones")
+	}
+	assert.Equal(t, http.StatusBadGateway, events[0].StatusCode)
+	assert.Equal(t, `{"jsonrpc": "2.0","result": {"status": "ok"},"id": "1"}`, string(events[1].ResponseBody))
+}
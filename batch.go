@@ -0,0 +1,314 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BatchCall is a single call of the batch, Result and Err are set once the batch is completed
+type BatchCall struct {
+	Request
+	Result interface{} // Target to decode the result into
+	Err    error       // RPC error of this call or the reason it got no result
+}
+
+// BatchCaller is implemented by clients able to send several calls in a single request
+type BatchCaller interface {
+	CallBatch(ctx context.Context, calls []*BatchCall) error
+}
+
+// BatchSigning defines how batch requests are signed
+type BatchSigning int
+
+const (
+	// BatchSignBody signs the exact bytes of the serialized batch array, just like a single request body
+	BatchSignBody BatchSigning = iota
+	// BatchSignElements additionally signs every serialized sub-request on its own. The signatures are sent
+	// comma separated in X-Batch-Signatures header in the order of the sub-requests
+	BatchSignElements
+)
+
+var _ BatchCaller = apiClient{}
+
+// CallBatch sends the calls as a single JSON-RPC batch and matches the responses to the calls by id.
+// Calls without id are numbered by their position. The Authorization header covers the exact batch body,
+// see Config.BatchSigning to sign sub-requests as well. Request versions are ignored, the batch goes to BaseURL.
+// The error is returned only if the batch as a whole has failed, errors of the calls are set to BatchCall.Err.
+// DuplicateResponseIDError is returned along with the results of the calls which are not ambiguous
+func (c apiClient) CallBatch(ctx context.Context, calls []*BatchCall) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if len(calls) == 0 {
+		return errors.New("batch is empty")
+	}
+
+	ids := make(map[string]bool, len(calls))
+	for i, call := range calls {
+		call.Method = strings.TrimSpace(call.Method)
+		if call.Method == "" {
+			return ErrEmptyMethod
+		}
+
+		id, err := c.requestID(call.ID)
+		if err != nil {
+			return err
+		}
+		if id == "" {
+			id = strconv.Itoa(i + 1)
+		}
+		call.ID = id
+
+		if ids[strings.ToLower(call.ID)] {
+			return fmt.Errorf("duplicate request id %q in the batch", call.ID)
+		}
+		ids[strings.ToLower(call.ID)] = true
+	}
+
+	if c.breaker != nil {
+		if err := c.breaker.allow(); err != nil {
+			return err
+		}
+	}
+
+	if c.semaphore != nil {
+		select {
+		case c.semaphore <- struct{}{}:
+			defer func() { <-c.semaphore }()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if c.stats != nil {
+		defer c.stats.begin()()
+	}
+
+	call := &rpcCall{batch: calls, info: &CallInfo{Method: "batch", Metadata: MetadataFromContext(ctx)}}
+
+	var req *http.Request
+	var sign func() error
+	var err error
+	if c.Config.StreamBatchBody {
+		// the body is signed while it's streamed, so every attempt is signed with the current credentials
+		if req, err = c.newStreamedBatchRequest(ctx, calls); err != nil {
+			return err
+		}
+		sign = func() error { return nil }
+	} else {
+		var elements [][]byte
+		if elements, err = c.encodeBatch(calls); err != nil {
+			return err
+		}
+		body := append(append([]byte{'['}, bytes.Join(elements, []byte{','})...), ']')
+
+		c.log(ctx, DebugLevel, "request body: %s", body)
+
+		if req, err = http.NewRequestWithContext(ctx, http.MethodPost, c.Config.BaseURL, bytes.NewReader(body)); err != nil {
+			return err
+		}
+		sign = func() error { return c.signBatch(req, body, elements) }
+
+		if c.envelopes != nil {
+			c.emitEnvelope(EnvelopeRequest, call, body)
+		}
+		c.teeRequest(ctx, body)
+	}
+
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	c.setAccept(req)
+	if err = sign(); err != nil {
+		return err
+	}
+
+	start := time.Now()
+
+	err = c.sendRequest(req, call)
+	if c.Config.OnUnauthorized != nil && isUnauthorized(err) {
+		err = c.retryUnauthorized(req, call, sign)
+	}
+
+	call.info.Duration = time.Since(start)
+	call.info.Err = err
+	if c.Config.OnComplete != nil {
+		c.Config.OnComplete(*call.info)
+	}
+
+	return err
+}
+
+// signBatch signs the batch body and the sub-requests if Config.BatchSigning asks to
+func (c apiClient) signBatch(req *http.Request, body []byte, elements [][]byte) error {
+	if err := c.sign(req, body); err != nil {
+		return err
+	}
+
+	if c.Config.BatchSigning != BatchSignElements {
+		return nil
+	}
+
+	publicKey, secret, err := c.credentials(req.Context())
+	if err != nil {
+		return err
+	}
+
+	signatures := make([]string, len(elements))
+	for i, element := range elements {
+		if signatures[i], err = c.signer()(publicKey, secret, element); err != nil {
+			return err
+		}
+	}
+	req.Header.Set("X-Batch-Signatures", strings.Join(signatures, ","))
+
+	return nil
+}
+
+// encodeBatch serializes every call to the JSON-RPC request object
+func (c apiClient) encodeBatch(calls []*BatchCall) ([][]byte, error) {
+	codec := c.codec()
+	elements := make([][]byte, len(calls))
+	for i, call := range calls {
+		element, err := c.encodeBatchCall(codec, call)
+		if err != nil {
+			return nil, err
+		}
+		elements[i] = element
+	}
+
+	return elements, nil
+}
+
+// encodeBatchCall serializes the call to the JSON-RPC request object
+func (c apiClient) encodeBatchCall(codec Codec, call *BatchCall) ([]byte, error) {
+	params, ok := call.Params.(json.RawMessage)
+	if !ok {
+		encoded, err := codec.Marshal(call.Params)
+		if err != nil {
+			return nil, err
+		}
+		params = encoded
+	}
+
+	rpcReq := newRPCRequest(c.qualifiedMethod(call.Method), params, call.ID)
+	id, err := c.typedID(call.ID)
+	if err != nil {
+		return nil, err
+	}
+	rpcReq.ID = id
+
+	element, err := json.Marshal(rpcReq)
+	if err != nil {
+		return nil, err
+	}
+	if c.Config.CanonicalJSON {
+		if element, err = canonicalJSON(element); err != nil {
+			return nil, err
+		}
+	}
+
+	return element, nil
+}
+
+// decodeBatch matches the responses of the batch to the calls by id
+func (c apiClient) decodeBatch(body io.Reader, calls []*BatchCall) error {
+	var raw json.RawMessage
+	if err := json.NewDecoder(body).Decode(&raw); err != nil {
+		return err
+	}
+
+	// the server responds with a single object if it has rejected the batch as a whole
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '{' {
+		single := &rpcResponse{}
+		if err := json.Unmarshal(trimmed, single); err != nil {
+			return err
+		}
+		if single.Error != nil {
+			return single.Error
+		}
+		return errors.New("batch response is not an array")
+	}
+
+	var responses []rpcResponse
+	if err := json.Unmarshal(raw, &responses); err != nil {
+		return err
+	}
+
+	// the calls are looked up by the ids as they're sent, so the number ids match the type of the response ids
+	byID := make(map[string]*BatchCall, len(calls))
+	for _, call := range calls {
+		call.Err = fmt.Errorf("no response for request id %q", call.ID)
+		id, err := c.typedID(call.ID)
+		if err != nil {
+			id = rpcID{value: call.ID}
+		}
+		byID[id.key()] = call
+	}
+
+	// the results of the ids responded several times are ambiguous, so none of them is delivered
+	counts := make(map[string]int, len(responses))
+	var duplicates []string
+	for _, resp := range responses {
+		id := resp.ID.key()
+		if counts[id]++; counts[id] == 2 {
+			if call, ok := byID[id]; ok {
+				duplicates = append(duplicates, call.ID)
+			}
+		}
+	}
+	var duplicateErr *DuplicateResponseIDError
+	if len(duplicates) > 0 {
+		duplicateErr = &DuplicateResponseIDError{IDs: duplicates}
+	}
+
+	codec := c.codec()
+	for _, resp := range responses {
+		call, ok := byID[resp.ID.key()]
+		if !ok {
+			c.log(context.Background(), WarningLevel, "unexpected response id %s in the batch", resp.ID)
+			continue
+		}
+
+		if counts[resp.ID.key()] > 1 {
+			call.Err = duplicateErr
+			continue
+		}
+
+		if call.Result == nil && resp.Error == nil && c.Config.BatchResultFactory != nil {
+			call.Result = c.Config.BatchResultFactory(call.Method, call.ID)
+		}
+
+		switch {
+		case resp.Error != nil:
+			call.Err = resp.Error
+		case len(resp.Result) > 0 && call.Result != nil:
+			call.Err = codec.Unmarshal(resp.Result, call.Result)
+		default:
+			call.Err = nil
+		}
+	}
+
+	if duplicateErr != nil {
+		return duplicateErr
+	}
+
+	return nil
+}
+
+// DuplicateResponseIDError is returned by CallBatch if the server has responded several times to the same ids.
+// The calls of these ids fail with the error too, the rest of the calls get their results as usual
+type DuplicateResponseIDError struct {
+	IDs []string
+}
+
+func (e *DuplicateResponseIDError) Error() string {
+	return fmt.Sprintf("duplicate response ids in the batch: %s", strings.Join(e.IDs, ", "))
+}
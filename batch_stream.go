@@ -0,0 +1,99 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// newStreamedBatchRequest creates the batch request encoding the calls one by one while the body is sent,
+// so the batch is never kept in memory as a whole. The body can't be signed before it's sent, hence
+// the signature of Hmac256Signer is computed along the way and sent in the Authorization trailer
+func (c apiClient) newStreamedBatchRequest(ctx context.Context, calls []*BatchCall) (*http.Request, error) {
+	customSigner := c.RequestSigner != nil || c.contextSigner != nil || c.Config.TimestampSigner != nil
+	if customSigner || c.Config.BatchSigning == BatchSignElements {
+		return nil, errors.New("streamed batch body can be signed by the default HMAC signer only")
+	}
+
+	// the ids are checked upfront, since the encoding error fails the request once it's being sent
+	for _, call := range calls {
+		if _, err := c.typedID(call.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Config.BaseURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// every attempt takes its body from GetBody, so the encoding starts only once the request is being sent
+	req.ContentLength = -1 // chunked
+	req.Trailer = http.Header{"Authorization": nil}
+	req.GetBody = func() (io.ReadCloser, error) {
+		return c.streamBatch(ctx, req.Trailer, calls), nil
+	}
+
+	return req, nil
+}
+
+// streamBatch returns the body the calls are encoded to by the tracked goroutine
+func (c apiClient) streamBatch(ctx context.Context, trailer http.Header, calls []*BatchCall) io.ReadCloser {
+	reader, writer := io.Pipe()
+	started := c.goTracked(func() {
+		// the transport closes the body once it has failed, so the goroutine never outlives the request
+		writer.CloseWithError(c.writeBatch(ctx, writer, trailer, calls))
+	})
+	if !started {
+		writer.CloseWithError(ErrClientClosed)
+	}
+
+	return reader
+}
+
+// writeBatch encodes the calls to the writer and sets the Authorization trailer once the body is written
+func (c apiClient) writeBatch(ctx context.Context, w io.Writer, trailer http.Header, calls []*BatchCall) error {
+	publicKey, secret, err := c.credentials(ctx)
+	if err != nil {
+		return err
+	}
+
+	// the same as Hmac256Signer does, but along with writing the body
+	mac := hmac.New(sha256.New, []byte(secret))
+	bodyEncoder := base64.NewEncoder(base64.RawURLEncoding, mac)
+	out := bufio.NewWriter(io.MultiWriter(w, bodyEncoder))
+
+	codec := c.codec()
+	var element []byte
+	_ = out.WriteByte('[')
+	for i, call := range calls {
+		if i > 0 {
+			_ = out.WriteByte(',')
+		}
+
+		if element, err = c.encodeBatchCall(codec, call); err != nil {
+			return err
+		}
+		if _, err = out.Write(element); err != nil {
+			return err
+		}
+	}
+	_ = out.WriteByte(']')
+	if err = out.Flush(); err != nil {
+		return err
+	}
+	if err = bodyEncoder.Close(); err != nil {
+		return err
+	}
+
+	signature := base64.StdEncoding.EncodeToString([]byte(publicKey + ":" + hex.EncodeToString(mac.Sum(nil))))
+	trailer.Set("Authorization", c.authScheme()+" "+signature)
+
+	return nil
+}
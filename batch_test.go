@@ -0,0 +1,406 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_CallBatch(t *testing.T) {
+	server := testServer(`[
+		{"jsonrpc": "2.0", "error": {"code": -32601, "message": "Method not found"}, "id": "2"},
+		{"jsonrpc": "2.0", "result": {"key": "Value"}, "id": "1"}
+	]`)
+	defer server.Close()
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL: server.URL,
+		},
+	}
+
+	result := &struct {
+		Key string `json:"key"`
+	}{}
+	calls := []*BatchCall{
+		{Request: Request{Method: "any.method"}, Result: result},
+		{Request: Request{Method: "unknown.method"}},
+		{Request: Request{Method: "lost.method", ID: "lost"}},
+	}
+	err := client.CallBatch(context.Background(), calls)
+
+	assert.NoError(t, err)
+	assert.NoError(t, calls[0].Err)
+	assert.Equal(t, "Value", result.Key)
+	assert.EqualError(t, calls[1].Err, "Method not found (-32601)")
+	assert.EqualError(t, calls[2].Err, `no response for request id "lost"`)
+}
+
+func TestClient_CallBatch_Rejected(t *testing.T) {
+	server := testServer(`{"jsonrpc": "2.0", "error": {"code": -32600, "message": "Invalid Request"}, "id": null}`)
+	defer server.Close()
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL: server.URL,
+		},
+	}
+
+	err := client.CallBatch(context.Background(), []*BatchCall{{Request: Request{Method: "any.method"}}})
+
+	assert.EqualError(t, err, "Invalid Request (-32600)")
+}
+
+func TestClient_CallBatch_DuplicateRequestID(t *testing.T) {
+	client := apiClient{Config: &Config{}}
+
+	err := client.CallBatch(context.Background(), []*BatchCall{
+		{Request: Request{Method: "any.method", ID: "1"}},
+		{Request: Request{Method: "any.method"}}, // numbered as 2
+		{Request: Request{Method: "any.method", ID: "2"}},
+	})
+
+	assert.EqualError(t, err, `duplicate request id "2" in the batch`)
+}
+
+func batchSigningServer(t *testing.T, elements bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, err := ioutil.ReadAll(req.Body)
+		assert.NoError(t, err)
+
+		valid, err := VerifySignature("public", "secret", body, req.Header.Get("Authorization"))
+		assert.NoError(t, err)
+		assert.True(t, valid, "batch signature")
+
+		var items []json.RawMessage
+		assert.NoError(t, json.Unmarshal(body, &items))
+
+		signatures := req.Header.Get("X-Batch-Signatures")
+		if !elements {
+			assert.Empty(t, signatures)
+		} else if assert.NotEmpty(t, signatures) {
+			split := strings.Split(signatures, ",")
+			assert.Len(t, split, len(items))
+			for i, item := range items {
+				valid, err = VerifySignature("public", "secret", item, split[i])
+				assert.NoError(t, err)
+				assert.True(t, valid, "signature of item %d", i)
+			}
+		}
+
+		_, _ = rw.Write([]byte(`[{"jsonrpc": "2.0", "result": 1, "id": "1"}, {"jsonrpc": "2.0", "result": 2, "id": "2"}]`))
+	}))
+}
+
+func TestClient_CallBatch_Signing(t *testing.T) {
+	for name, signing := range map[string]BatchSigning{"body": BatchSignBody, "elements": BatchSignElements} {
+		t.Run(name, func(t *testing.T) {
+			server := batchSigningServer(t, signing == BatchSignElements)
+			defer server.Close()
+
+			config := NewConfig("public", "secret")
+			config.BaseURL = server.URL
+			config.BatchSigning = signing
+
+			var first, second int
+			calls := []*BatchCall{
+				{Request: Request{Method: "first.method", Params: map[string]int{"a": 1}}, Result: &first},
+				{Request: Request{Method: "second.method", Params: []string{"b"}}, Result: &second},
+			}
+			err := New(config).(BatchCaller).CallBatch(context.Background(), calls)
+
+			assert.NoError(t, err)
+			assert.Equal(t, 1, first)
+			assert.Equal(t, 2, second)
+		})
+	}
+}
+
+func TestClient_CallBatch_ResultFactory(t *testing.T) {
+	server := testServer(`[
+		{"jsonrpc": "2.0", "result": {"transaction_id": "tx-1"}, "id": "2"},
+		{"jsonrpc": "2.0", "result": {"merchant_id": 7, "name": "shop"}, "id": "1"}
+	]`)
+	defer server.Close()
+
+	type merchant struct {
+		MerchantID int    `json:"merchant_id"`
+		Name       string `json:"name"`
+	}
+	type transaction struct {
+		TransactionID string `json:"transaction_id"`
+	}
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL: server.URL,
+			BatchResultFactory: func(method, id string) interface{} {
+				switch method {
+				case "merchant.getDetails":
+					return &merchant{}
+				case "transaction.getDetails":
+					return &transaction{}
+				}
+				return nil
+			},
+		},
+	}
+
+	calls := []*BatchCall{
+		{Request: Request{Method: "merchant.getDetails"}},
+		{Request: Request{Method: "transaction.getDetails"}},
+	}
+	err := client.CallBatch(context.Background(), calls)
+
+	assert.NoError(t, err)
+	assert.NoError(t, calls[0].Err)
+	assert.Equal(t, &merchant{MerchantID: 7, Name: "shop"}, calls[0].Result)
+	assert.NoError(t, calls[1].Err)
+	assert.Equal(t, &transaction{TransactionID: "tx-1"}, calls[1].Result)
+}
+
+func TestClient_CallBatch_DuplicateResponseID(t *testing.T) {
+	server := testServer(`[
+		{"jsonrpc": "2.0", "result": {"key": "First"}, "id": "1"},
+		{"jsonrpc": "2.0", "result": {"key": "Value"}, "id": "2"},
+		{"jsonrpc": "2.0", "result": {"key": "Second"}, "id": "1"}
+	]`)
+	defer server.Close()
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL: server.URL,
+		},
+	}
+
+	type result struct {
+		Key string `json:"key"`
+	}
+	ambiguous, unambiguous := &result{}, &result{}
+	calls := []*BatchCall{
+		{Request: Request{Method: "any.method"}, Result: ambiguous},
+		{Request: Request{Method: "other.method"}, Result: unambiguous},
+	}
+	err := client.CallBatch(context.Background(), calls)
+
+	var duplicateErr *DuplicateResponseIDError
+	assert.True(t, errors.As(err, &duplicateErr))
+	assert.Equal(t, []string{"1"}, duplicateErr.IDs)
+	assert.EqualError(t, err, "duplicate response ids in the batch: 1")
+
+	assert.Equal(t, duplicateErr, calls[0].Err)
+	assert.Empty(t, ambiguous.Key)
+	assert.NoError(t, calls[1].Err)
+	assert.Equal(t, "Value", unambiguous.Key)
+}
+
+// batchEchoServer verifies the signature of the batch given in the Authorization trailer
+// and responds to every call with its position
+func batchEchoServer(t testing.TB) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, err := ioutil.ReadAll(req.Body)
+		assert.NoError(t, err)
+
+		signature := req.Header.Get("Authorization")
+		if signature == "" {
+			signature = req.Trailer.Get("Authorization")
+		}
+		valid, err := VerifySignature("public", "secret", body, signature)
+		if err != nil || !valid {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var requests []rpcRequest
+		assert.NoError(t, json.Unmarshal(body, &requests))
+
+		enc := json.NewEncoder(rw)
+		_, _ = rw.Write([]byte{'['})
+		for i, r := range requests {
+			if i > 0 {
+				_, _ = rw.Write([]byte{','})
+			}
+			_ = enc.Encode(map[string]interface{}{"jsonrpc": "2.0", "result": r.ID.value, "id": r.ID})
+		}
+		_, _ = rw.Write([]byte{']'})
+	}))
+}
+
+func newBatchCalls(n int) []*BatchCall {
+	calls := make([]*BatchCall, n)
+	for i := range calls {
+		calls[i] = &BatchCall{
+			Request: Request{Method: "event.notify", Params: map[string]int{"event_id": i}},
+			Result:  new(string),
+		}
+	}
+
+	return calls
+}
+
+func TestClient_CallBatch_NumberIDs(t *testing.T) {
+	server := testServer(`[
+		{"jsonrpc": "2.0", "result": {"key": "String"}, "id": "7"},
+		{"jsonrpc": "2.0", "result": {"key": "Number"}, "id": 7}
+	]`)
+	defer server.Close()
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL: server.URL,
+			IDType:  IDTypeNumber,
+		},
+	}
+
+	type result struct {
+		Key string `json:"key"`
+	}
+	calls := []*BatchCall{{Request: Request{Method: "any.method", ID: "007"}, Result: &result{}}}
+	err := client.CallBatch(context.Background(), calls)
+
+	assert.NoError(t, err)
+	assert.NoError(t, calls[0].Err)
+	assert.Equal(t, "Number", calls[0].Result.(*result).Key, "the string id doesn't match the number one")
+}
+
+func TestClient_CallBatch_StreamBatchBody(t *testing.T) {
+	server := batchEchoServer(t)
+	defer server.Close()
+
+	config := NewConfig("public", "secret")
+	config.BaseURL = server.URL
+	config.StreamBatchBody = true
+	client := New(config).(BatchCaller)
+
+	calls := newBatchCalls(10000)
+	assert.NoError(t, client.CallBatch(context.Background(), calls))
+
+	for i, call := range calls {
+		assert.NoError(t, call.Err)
+		assert.Equal(t, strconv.Itoa(i+1), *call.Result.(*string))
+	}
+	assert.Equal(t, 0, client.(AsyncCaller).InFlightRequests(), "the encoding goroutine is completed")
+}
+
+func TestClient_CallBatch_OnUnauthorized(t *testing.T) {
+	server := batchEchoServer(t)
+	defer server.Close()
+
+	credentials := &rotatingCredentials{secret: "stale"}
+	var refreshes int
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL:     server.URL,
+			Credentials: credentials,
+			OnUnauthorized: func(ctx context.Context) error {
+				refreshes++
+				credentials.secret = "secret"
+				return nil
+			},
+		},
+	}
+
+	calls := newBatchCalls(2)
+	assert.NoError(t, client.CallBatch(context.Background(), calls))
+	assert.Equal(t, 1, refreshes)
+	assert.Equal(t, "2", *calls[1].Result.(*string))
+}
+
+func TestClient_CallBatch_StreamBatchBodySigners(t *testing.T) {
+	config := NewConfig("public", "secret")
+	config.StreamBatchBody = true
+	config.BatchSigning = BatchSignElements
+
+	err := New(config).(BatchCaller).CallBatch(context.Background(), newBatchCalls(1))
+	assert.EqualError(t, err, "streamed batch body can be signed by the default HMAC signer only")
+
+	custom := apiClient{
+		Config: &Config{BaseURL: "http://localhost", StreamBatchBody: true},
+		RequestSigner: func(publicKey, secret string, body []byte) (string, error) {
+			return "custom", nil
+		},
+	}
+	err = custom.CallBatch(context.Background(), newBatchCalls(1))
+	assert.EqualError(t, err, "streamed batch body can be signed by the default HMAC signer only")
+}
+
+// countingCodec counts the params encoded by the default codec
+type countingCodec struct {
+	JSONCodec
+	marshaled int32
+}
+
+func (c *countingCodec) Marshal(v interface{}) ([]byte, error) {
+	atomic.AddInt32(&c.marshaled, 1)
+	return c.JSONCodec.Marshal(v)
+}
+
+func TestClient_CallBatch_StreamBatchBodyCapture(t *testing.T) {
+	server := batchEchoServer(t)
+	defer server.Close()
+
+	var events []AuditEvent
+	var har bytes.Buffer
+	codec := &countingCodec{}
+	config := NewConfig("public", "secret")
+	config.BaseURL = server.URL
+	config.StreamBatchBody = true
+	config.Codec = codec
+	config.AuditHook = func(event AuditEvent) {
+		events = append(events, event)
+	}
+	client := New(config, WithHARWriter(&har)).(BatchCaller)
+
+	calls := newBatchCalls(3)
+	assert.NoError(t, client.CallBatch(context.Background(), calls))
+
+	assert.Equal(t, int32(len(calls)), atomic.LoadInt32(&codec.marshaled), "the batch is encoded just once")
+	if assert.Len(t, events, 1) {
+		assert.Nil(t, events[0].RequestBody)
+		assert.Equal(t, http.StatusOK, events[0].StatusCode)
+	}
+
+	var entry harEntry
+	assert.NoError(t, json.Unmarshal(har.Bytes(), &entry))
+	assert.Nil(t, entry.Request.PostData)
+	assert.Equal(t, -1, entry.Request.BodySize)
+}
+
+// BenchmarkClient_CallBatch compares the memory allocated to send the batch buffered and streamed
+func BenchmarkClient_CallBatch(b *testing.B) {
+	server := batchEchoServer(b)
+	defer server.Close()
+
+	for _, streamed := range []bool{false, true} {
+		b.Run(fmt.Sprintf("streamed=%t", streamed), func(b *testing.B) {
+			config := NewConfig("public", "secret")
+			config.BaseURL = server.URL
+			config.StreamBatchBody = streamed
+			client := New(config).(BatchCaller)
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := client.CallBatch(context.Background(), newBatchCalls(10000)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
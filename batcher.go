@@ -0,0 +1,140 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrBatcherClosed is returned when the call is added to the closed Batcher
+var ErrBatcherClosed = errors.New("batcher is closed")
+
+// BatcherConfig defines when Batcher sends the accumulated calls
+type BatcherConfig struct {
+	MaxSize  int           // Number of calls sending the batch right away, unlimited if zero
+	Interval time.Duration // Period of sending the accumulated calls, disabled if zero
+	// OnFlushed is called after every batch with the batch error, errors of the calls are set to BatchCall.Err
+	OnFlushed func(calls []*BatchCall, err error)
+}
+
+// Batcher accumulates calls, e.g. event notifications, and sends them as batches by size and by time.
+// It's safe for concurrent use
+type Batcher struct {
+	caller BatchCaller
+	config BatcherConfig
+
+	mu      sync.Mutex
+	pending []*BatchCall
+	closed  bool
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// NewBatcher creates a Batcher sending the batches with the caller, e.g. the client created by New
+func NewBatcher(caller BatchCaller, config BatcherConfig) *Batcher {
+	b := &Batcher{
+		caller:  caller,
+		config:  config,
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	if config.Interval > 0 {
+		go b.flushPeriodically()
+	} else {
+		close(b.stopped)
+	}
+
+	return b
+}
+
+// Add enqueues the call. The batch is sent by the calling goroutine once MaxSize calls are accumulated
+func (b *Batcher) Add(method string, params interface{}) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrBatcherClosed
+	}
+
+	b.pending = append(b.pending, &BatchCall{Request: Request{Method: method, Params: params}})
+	var calls []*BatchCall
+	if b.config.MaxSize > 0 && len(b.pending) >= b.config.MaxSize {
+		calls = b.takePending()
+	}
+	b.mu.Unlock()
+
+	if calls != nil {
+		_ = b.send(context.Background(), calls)
+	}
+
+	return nil
+}
+
+// Flush sends the accumulated calls right away
+func (b *Batcher) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	calls := b.takePending()
+	b.mu.Unlock()
+
+	if calls == nil {
+		return nil
+	}
+
+	return b.send(ctx, calls)
+}
+
+// Close stops the periodic sending and flushes the accumulated calls, later calls of Add fail with ErrBatcherClosed
+func (b *Batcher) Close(ctx context.Context) error {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.stop)
+	}
+	b.mu.Unlock()
+
+	select {
+	case <-b.stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return b.Flush(ctx)
+}
+
+func (b *Batcher) flushPeriodically() {
+	defer close(b.stopped)
+
+	ticker := time.NewTicker(b.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+			_ = b.Flush(context.Background())
+		}
+	}
+}
+
+// takePending returns the accumulated calls, nil if there are none. The mutex has to be held
+func (b *Batcher) takePending() []*BatchCall {
+	if len(b.pending) == 0 {
+		return nil
+	}
+
+	calls := b.pending
+	b.pending = nil
+
+	return calls
+}
+
+func (b *Batcher) send(ctx context.Context, calls []*BatchCall) error {
+	err := b.caller.CallBatch(ctx, calls)
+	if b.config.OnFlushed != nil {
+		b.config.OnFlushed(calls, err)
+	}
+
+	return err
+}
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// batchRecorder records the methods of every batch sent
+type batchRecorder struct {
+	mu      sync.Mutex
+	batches [][]string
+}
+
+func (r *batchRecorder) CallBatch(ctx context.Context, calls []*BatchCall) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	methods := make([]string, 0, len(calls))
+	for _, call := range calls {
+		methods = append(methods, call.Method)
+	}
+	r.batches = append(r.batches, methods)
+
+	return nil
+}
+
+func (r *batchRecorder) sent() [][]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([][]string(nil), r.batches...)
+}
+
+func TestBatcher_MaxSize(t *testing.T) {
+	recorder := &batchRecorder{}
+	batcher := NewBatcher(recorder, BatcherConfig{MaxSize: 3})
+
+	for _, method := range []string{"event.1", "event.2", "event.3", "event.4", "event.5"} {
+		assert.NoError(t, batcher.Add(method, struct{}{}))
+	}
+	assert.Equal(t, [][]string{{"event.1", "event.2", "event.3"}}, recorder.sent())
+
+	assert.NoError(t, batcher.Close(context.Background()))
+	assert.Equal(t, [][]string{{"event.1", "event.2", "event.3"}, {"event.4", "event.5"}}, recorder.sent())
+
+	assert.True(t, errors.Is(batcher.Add("event.6", struct{}{}), ErrBatcherClosed))
+}
+
+func TestBatcher_Interval(t *testing.T) {
+	recorder := &batchRecorder{}
+	flushed := make(chan int, 2)
+	batcher := NewBatcher(recorder, BatcherConfig{
+		Interval: 10 * time.Millisecond,
+		OnFlushed: func(calls []*BatchCall, err error) {
+			assert.NoError(t, err)
+			flushed <- len(calls)
+		},
+	})
+	defer batcher.Close(context.Background())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, batcher.Add("event.created", struct{}{}))
+		}()
+	}
+	wg.Wait()
+
+	// the ticker may fire in between the calls, so they are sent in one or two batches
+	for sent := 0; sent < 2; {
+		select {
+		case size := <-flushed:
+			sent += size
+		case <-time.After(time.Second):
+			t.Fatal("the calls are not sent")
+		}
+	}
+}
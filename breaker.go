@@ -0,0 +1,102 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned when the circuit breaker stops calls after too many failures
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+const defaultCircuitBreakerCooldown = 30 * time.Second
+
+// circuitBreaker opens after the threshold of consecutive failed attempts made by all calls of the client
+// and rejects calls until the cooldown passes. Calls sleeping in backoff are woken up once it opens
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openedAt  time.Time
+	opened    chan struct{} // closed when the circuit opens
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	if cooldown <= 0 {
+		cooldown = defaultCircuitBreakerCooldown
+	}
+
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		opened:    make(chan struct{}),
+	}
+}
+
+// allow returns ErrCircuitOpen while the circuit is open
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.isOpen() && time.Since(b.openedAt) < b.cooldown {
+		return ErrCircuitOpen
+	}
+
+	return nil
+}
+
+// stopped returns the channel closed once the circuit opens
+func (b *circuitBreaker) stopped() <-chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.opened
+}
+
+// record counts the attempt outcome, server errors and failed requests are considered as failures
+func (b *circuitBreaker) record(resp *http.Response, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil && resp.StatusCode < 500 {
+		b.failures = 0
+		if b.isOpen() {
+			b.opened = make(chan struct{})
+		}
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedAt = time.Now()
+		if !b.isOpen() {
+			close(b.opened)
+		}
+	}
+}
+
+// state reports the circuit state for Stats
+func (b *circuitBreaker) state() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case !b.isOpen():
+		return CircuitClosed
+	case time.Since(b.openedAt) < b.cooldown:
+		return CircuitOpen
+	default:
+		return CircuitHalfOpen
+	}
+}
+
+func (b *circuitBreaker) isOpen() bool {
+	select {
+	case <-b.opened:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_Call_CircuitOpensDuringBackoff(t *testing.T) {
+	firstAttempt := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		select {
+		case firstAttempt <- struct{}{}:
+		default:
+		}
+		rw.WriteHeader(500)
+	}))
+
+	cfg := NewConfig("key", "secret")
+	cfg.BaseURL = server.URL
+	cfg.RetryMax = 1
+	cfg.RetryWaitMin = 10 * time.Second
+	cfg.BackoffStrategy = BackoffConstant
+	cfg.CircuitBreakerThreshold = 2
+	client := New(cfg).(*apiClient)
+	client.HTTPClient = server.Client()
+
+	sleeping := make(chan error, 1)
+	start := time.Now()
+	go func() {
+		sleeping <- client.Call("any.method", struct{}{}, &struct{}{})
+	}()
+
+	<-firstAttempt
+	// the second failure trips the breaker while the first call sleeps in backoff
+	err := client.Call("any.method", struct{}{}, &struct{}{})
+	assert.Equal(t, ErrCircuitOpen, err)
+
+	select {
+	case err = <-sleeping:
+		assert.Equal(t, ErrCircuitOpen, err)
+		assert.Less(t, time.Since(start).Nanoseconds(), time.Second.Nanoseconds())
+	case <-time.After(5 * time.Second):
+		t.Fatal("the call sleeping in backoff wasn't aborted")
+	}
+
+	// the circuit rejects calls without a request until the cooldown passes
+	assert.Equal(t, ErrCircuitOpen, client.Call("any.method", struct{}{}, &struct{}{}))
+}
+
+func TestCircuitBreaker_ResetOnSuccess(t *testing.T) {
+	breaker := newCircuitBreaker(1, time.Millisecond)
+
+	breaker.record(&http.Response{StatusCode: 500}, nil)
+	assert.Equal(t, ErrCircuitOpen, breaker.allow())
+
+	time.Sleep(2 * time.Millisecond)
+	assert.NoError(t, breaker.allow())
+
+	breaker.record(&http.Response{StatusCode: 200}, nil)
+	assert.NoError(t, breaker.allow())
+	select {
+	case <-breaker.stopped():
+		t.Fatal("circuit is expected to be closed")
+	default:
+	}
+}
@@ -0,0 +1,170 @@
+package client
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// ErrStaleResult tells the result has been served from the cache because the call has failed
+var ErrStaleResult = errors.New("stale result served from cache")
+
+// StaleResultError is returned along with the cached result when Config.ServeStaleOnError is set.
+// It matches ErrStaleResult and unwraps to the failure of the call
+type StaleResultError struct {
+	Err error
+}
+
+func (e *StaleResultError) Error() string {
+	return ErrStaleResult.Error() + ": " + e.Err.Error()
+}
+
+// Unwrap returns the failure of the call
+func (e *StaleResultError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports the error as ErrStaleResult
+func (e *StaleResultError) Is(target error) bool {
+	return target == ErrStaleResult
+}
+
+// ResponseCache stores results of idempotent methods along with their ETag
+type ResponseCache interface {
+	Get(key string) (etag string, result []byte, ok bool)
+	Set(key, etag string, result []byte)
+}
+
+// defaultMemoryCacheEntries limits the entries of the cache returned by NewMemoryResponseCache
+const defaultMemoryCacheEntries = 1024
+
+// NewMemoryResponseCache returns in-memory ResponseCache safe for concurrent use, which keeps up to
+// 1024 recently used results
+func NewMemoryResponseCache() ResponseCache {
+	return NewLimitedMemoryResponseCache(defaultMemoryCacheEntries)
+}
+
+// NewLimitedMemoryResponseCache returns in-memory ResponseCache safe for concurrent use, which evicts
+// the least recently used result once it holds maxEntries results
+func NewLimitedMemoryResponseCache(maxEntries int) ResponseCache {
+	if maxEntries < 1 {
+		maxEntries = 1
+	}
+
+	return &memoryResponseCache{
+		maxEntries: maxEntries,
+		entries:    map[string]*list.Element{},
+		recent:     list.New(),
+	}
+}
+
+type cacheEntry struct {
+	key    string
+	etag   string
+	result []byte
+}
+
+type memoryResponseCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	recent     *list.List // the most recently used entry goes first
+}
+
+// Get returns the cached result and its ETag
+func (c *memoryResponseCache) Get(key string) (etag string, result []byte, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return "", nil, false
+	}
+	c.recent.MoveToFront(element)
+
+	entry := element.Value.(*cacheEntry)
+	return entry.etag, entry.result, true
+}
+
+// Set stores the result and its ETag evicting the least recently used result if the cache is full
+func (c *memoryResponseCache) Set(key, etag string, result []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value = &cacheEntry{key: key, etag: etag, result: result}
+		c.recent.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.recent.PushFront(&cacheEntry{key: key, etag: etag, result: result})
+	if c.recent.Len() > c.maxEntries {
+		oldest := c.recent.Back()
+		c.recent.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// prepareCache sends the ETag of the cached result if the method is cacheable
+func (c apiClient) prepareCache(req *http.Request, call *rpcCall, method string, params json.RawMessage) {
+	cache := c.Config.ResponseCache
+	if cache == nil || call.stream != nil || !c.isCacheable(method) {
+		return
+	}
+
+	// the same call may return different results from another endpoint or for another merchant
+	publicKey, _, err := c.credentials(req.Context())
+	if err != nil {
+		return
+	}
+	call.cacheKey = publicKey + " " + req.URL.String() + " " + method + ":" + string(params)
+	if etag, result, ok := cache.Get(call.cacheKey); ok {
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		call.cached = result
+	}
+}
+
+// storeCache saves the result if the server tagged it or it may be served stale
+func (c apiClient) storeCache(resp *http.Response, call *rpcCall, result json.RawMessage) {
+	if call.cacheKey == "" {
+		return
+	}
+
+	// untagged results are kept only to be served when the server fails
+	if etag := resp.Header.Get("ETag"); etag != "" || c.Config.ServeStaleOnError {
+		c.Config.ResponseCache.Set(call.cacheKey, etag, result)
+	}
+}
+
+// serveStale decodes the cached result if the call has failed because of the transport or server error
+func (c apiClient) serveStale(call *rpcCall, err error) error {
+	var retryErr *RetryError
+	if call.cached == nil || !errors.As(err, &retryErr) {
+		return err
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode < 500 {
+		return err
+	}
+
+	if decodeErr := c.codec().Unmarshal(call.cached, call.result); decodeErr != nil {
+		return err
+	}
+
+	return &StaleResultError{Err: err}
+}
+
+func (c apiClient) isCacheable(method string) bool {
+	for _, m := range c.Config.CacheableMethods {
+		if m == method {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,161 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_Call_NotModified(t *testing.T) {
+	var reqCounter int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		reqCounter++
+		if reqCounter > 1 {
+			assert.Equal(t, `"v1"`, req.Header.Get("If-None-Match"))
+			rw.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		rw.Header().Set("ETag", `"v1"`)
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {"key": "Value"},"id": "1"}`))
+	}))
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL:          server.URL,
+			ResponseCache:    NewMemoryResponseCache(),
+			CacheableMethods: []string{"merchant.GetDetails"},
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		result := &struct {
+			Key string `json:"key"`
+		}{}
+		err := client.Call("merchant.GetDetails", struct{}{}, result)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Value", result.Key)
+	}
+	assert.Equal(t, 2, reqCounter)
+}
+
+func TestClient_Call_NotCacheableMethod(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.Empty(t, req.Header.Get("If-None-Match"))
+
+		rw.Header().Set("ETag", `"v1"`)
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {},"id": "1"}`))
+	}))
+
+	cache := NewMemoryResponseCache()
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL:          server.URL,
+			ResponseCache:    cache,
+			CacheableMethods: []string{"merchant.GetDetails"},
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		err := client.Call("merchant.Update", struct{}{}, &struct{}{})
+		assert.NoError(t, err)
+	}
+
+	_, _, ok := cache.Get("merchant.Update:{}")
+	assert.False(t, ok)
+}
+
+func TestClient_Call_ServeStaleOnError(t *testing.T) {
+	var failing bool
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if failing {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {"key": "Value"},"id": "1"}`))
+	}))
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL:           server.URL,
+			ResponseCache:     NewMemoryResponseCache(),
+			CacheableMethods:  []string{"merchant.GetDetails"},
+			ServeStaleOnError: true,
+		},
+	}
+
+	type keyResult struct {
+		Key string `json:"key"`
+	}
+
+	fresh := &keyResult{}
+	assert.NoError(t, client.Call("merchant.GetDetails", struct{}{}, fresh))
+	assert.Equal(t, "Value", fresh.Key)
+
+	failing = true
+	stale := &keyResult{}
+	err := client.Call("merchant.GetDetails", struct{}{}, stale)
+
+	assert.True(t, errors.Is(err, ErrStaleResult))
+	var statusErr *StatusError
+	if assert.True(t, errors.As(err, &statusErr)) {
+		assert.Equal(t, http.StatusServiceUnavailable, statusErr.StatusCode)
+	}
+	assert.Equal(t, "Value", stale.Key)
+
+	// nothing is cached for other params
+	err = client.Call("merchant.GetDetails", struct{ ID int }{ID: 1}, &keyResult{})
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrStaleResult))
+}
+
+func TestClient_Call_CacheKeyedByCredentialsAndEndpoint(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.Empty(t, req.Header.Get("If-None-Match"), "the result cached for another merchant or endpoint is not used")
+
+		rw.Header().Set("ETag", `"v1"`)
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {},"id": "1"}`))
+	}))
+	defer server.Close()
+
+	cache := NewMemoryResponseCache()
+	newClient := func(publicKey, baseURL string) apiClient {
+		config := NewConfig(publicKey, "secret")
+		config.BaseURL = baseURL
+		config.ResponseCache = cache
+		config.CacheableMethods = []string{"merchant.GetDetails"}
+		return apiClient{HTTPClient: server.Client(), Config: config}
+	}
+
+	for _, client := range []apiClient{
+		newClient("merchant-1", server.URL),
+		newClient("merchant-2", server.URL),
+		newClient("merchant-1", server.URL+"/v2"),
+	} {
+		assert.NoError(t, client.Call("merchant.GetDetails", struct{}{}, &struct{}{}))
+	}
+}
+
+func TestMemoryResponseCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewLimitedMemoryResponseCache(2)
+	cache.Set("a", "", []byte("1"))
+	cache.Set("b", "", []byte("2"))
+	_, _, _ = cache.Get("a")
+	cache.Set("c", "", []byte("3"))
+
+	_, _, ok := cache.Get("b")
+	assert.False(t, ok, "the least recently used result is evicted")
+	_, result, ok := cache.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), result)
+	_, _, ok = cache.Get("c")
+	assert.True(t, ok)
+}
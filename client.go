@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"context"
 	"crypto/hmac"
+	crand "crypto/rand"
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -15,18 +17,48 @@ import (
 	"io/ioutil"
 	"math"
 	"math/rand"
+	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"regexp"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
 	// BaseURLV3 is base url for API version 3
 	BaseURLV3 = "https://api.client.ch/v3"
+	// BaseURLV4 is base url for API version 4
+	BaseURLV4 = "https://api.client.ch/v4"
+	// DefaultHTTPTimeout is the overall time limit of a single HTTP request
+	DefaultHTTPTimeout = 60 * time.Second
+	// DefaultAuthScheme is the scheme of the Authorization header unless Config.AuthScheme is set
+	DefaultAuthScheme = "Basic"
+	// AttemptHeaderName is the conventional name of the header to enable with Config.AttemptHeader
+	AttemptHeaderName = "X-Retry-Attempt"
+	// DefaultAccept is the Accept header value unless Config.Accept is set
+	DefaultAccept = "application/json; charset=utf-8"
+	// OmitAccept set to Config.Accept makes the client send no Accept header
+	OmitAccept = "-"
 )
 
+// ErrEmptyMethod is returned when the method to call is empty
+var ErrEmptyMethod = errors.New("method is empty")
+
+// ErrRetryAfterExceedsDeadline is returned instead of waiting as the server has asked, if the context deadline
+// would pass in the meantime. See Config.FailOnRetryAfterDeadline
+var ErrRetryAfterExceedsDeadline = errors.New("retry after exceeds the deadline")
+
+// ErrRetryableResponse is wrapped by the error of Config.SuccessPredicate to have the vetoed response retried
+var ErrRetryableResponse = errors.New("retryable response")
+
+// ErrInsecureURL is returned if Config.RequireHTTPS is set and the request is about to be sent in cleartext
+var ErrInsecureURL = errors.New("signed request must be sent over https")
+
 var (
 	defaultRequestBackoff = ExponentialJitterBackoff
 	defaultRequestSigner  = Hmac256Signer
@@ -36,200 +68,1226 @@ var (
 type Client interface {
 	Call(method string, params, result interface{}) error
 	CallWithContext(ctx context.Context, method string, params, result interface{}) error
+	CallRequest(ctx context.Context, req Request, result interface{}) error
+	CallStream(ctx context.Context, method string, params interface{}, fn func(item json.RawMessage) error) error
+}
+
+// Request is the RPC request to call the API method with
+type Request struct {
+	Method  string
+	Params  interface{}
+	ID      string     // Defaults to "1" if empty
+	Version APIVersion // Pins the call to the API version instead of the one of Config.BaseURL
+}
+
+// validator is implemented by params which are able to check themselves before the request is sent
+type validator interface {
+	Validate() error
 }
 
 type apiClient struct {
 	Config         *Config
 	HTTPClient     *http.Client
 	RequestBackoff Backoff
-	RequestSigner  Signer
+	RequestSigner  Signer // Hmac256Signer if nil
+	semaphore      chan struct{}
+	breaker        *circuitBreaker
+	har            *harWriter
+	stats          *healthStats
+	async          *asyncTracker
+	clock          *clockOffset
+	envelopes      chan<- Envelope // set by WithEnvelopeChannel
+	stubs          *stubRegistry
+	tee            *bodyTee // set by WithBodyTee
+	pool           *poolStats
+
+	transport        http.RoundTripper // set by WithTransport
+	customHTTPClient bool              // set by WithHTTPClient
+	contextSigner    ContextSigner     // set by WithContextSigner
+
+	after func(d time.Duration) <-chan time.Time // waits out the backoff, time.After if nil
 }
 
-// New creates a new client instance
-func New(config *Config) Client {
-	return &apiClient{
-		Config: config,
-		HTTPClient: &http.Client{
-			Timeout: time.Second * 60,
-		},
-		RequestBackoff: defaultRequestBackoff,
-		RequestSigner:  defaultRequestSigner,
+// Option customizes the client created by New
+type Option func(c *apiClient)
+
+// New creates a new client instance. The client keeps a copy of the config, so the config may be shared
+// by several clients and changed afterwards without affecting them
+func New(config *Config, opts ...Option) Client {
+	config = config.clone()
+
+	var semaphore chan struct{}
+	if config.MaxConcurrentRequests > 0 {
+		semaphore = make(chan struct{}, config.MaxConcurrentRequests)
+	}
+
+	var pool *poolStats
+	if config.TrackConnectionPool {
+		pool = &poolStats{}
+	}
+
+	var breaker *circuitBreaker
+	if config.CircuitBreakerThreshold > 0 {
+		breaker = newCircuitBreaker(config.CircuitBreakerThreshold, config.CircuitBreakerCooldown)
+	}
+
+	c := &apiClient{
+		Config:         config,
+		HTTPClient:     newHTTPClient(config, pool),
+		RequestBackoff: backoffByName(config.BackoffStrategy, newJitterSource(), config.FirstRetry),
+		semaphore:      semaphore,
+		breaker:        breaker,
+		stats:          &healthStats{},
+		async:          &asyncTracker{},
+		clock:          &clockOffset{},
+		stubs:          &stubRegistry{},
+		pool:           pool,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.transport != nil && !c.customHTTPClient {
+		c.HTTPClient.Transport = c.transport
+	}
+
+	// Validate rejects it, but New doesn't fail, so the fallback is at least logged
+	if _, ok := backoffStrategies[config.BackoffStrategy]; !ok {
+		c.log(context.Background(), WarningLevel, "unknown backoff strategy %q, the exponential one is used", config.BackoffStrategy)
+	}
+
+	return c
+}
+
+// WithHTTPClient makes the client send requests with the given HTTP client as is,
+// so HTTPTimeout, LocalAddr, DialContext and WithTransport don't apply
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *apiClient) {
+		c.HTTPClient = httpClient
+		c.customHTTPClient = true
+	}
+}
+
+// WithTransport replaces the transport of the HTTP client built from Config, HTTPTimeout still applies.
+// LocalAddr and DialContext are ignored since they configure the default transport.
+// It has no effect along with WithHTTPClient whatever the order of the options is
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *apiClient) {
+		c.transport = transport
+	}
+}
+
+// WithContextSigner makes the client sign requests with the external signer instead of RequestSigner,
+// so the secret of the config is not used
+func WithContextSigner(signer ContextSigner) Option {
+	return func(c *apiClient) {
+		c.contextSigner = signer
+	}
+}
+
+func newHTTPClient(config *Config, pool *poolStats) *http.Client {
+	timeout := config.HTTPTimeout
+	if timeout <= 0 {
+		timeout = DefaultHTTPTimeout
+	}
+
+	httpClient := &http.Client{
+		Timeout: timeout,
+	}
+
+	dialContext := config.DialContext
+	if ip := net.ParseIP(config.LocalAddr); dialContext == nil && ip != nil {
+		dialer := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			LocalAddr: &net.TCPAddr{IP: ip},
+		}
+		dialContext = dialer.DialContext
+	}
+
+	hasTimeouts := config.TLSHandshakeTimeout > 0 || config.ResponseHeaderTimeout > 0 || config.ExpectContinueTimeout > 0
+	if dialContext != nil || hasTimeouts || pool != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if dialContext != nil {
+			transport.DialContext = dialContext
+		}
+		if pool != nil {
+			transport.DialContext = pool.dialContext(transport.DialContext)
+		}
+		if config.TLSHandshakeTimeout > 0 {
+			transport.TLSHandshakeTimeout = config.TLSHandshakeTimeout
+		}
+		if config.ResponseHeaderTimeout > 0 {
+			transport.ResponseHeaderTimeout = config.ResponseHeaderTimeout
+		}
+		if config.ExpectContinueTimeout > 0 {
+			transport.ExpectContinueTimeout = config.ExpectContinueTimeout
+		}
+		httpClient.Transport = transport
+	}
+
+	return httpClient
+}
+
+// Backoff allows to define different backoff scenarios to request retries
+type Backoff func(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration
+
+func retryAfter(resp *http.Response) time.Duration {
+	if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+		return retryAfterHeader(resp)
+	}
+
+	return 0
+}
+
+// retryAfterHeader returns the delay given in seconds by Retry-After header of any response
+func retryAfterHeader(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+
+	if sleep, err := strconv.ParseInt(resp.Header.Get("Retry-After"), 10, 64); err == nil {
+		return time.Second * time.Duration(sleep)
+	}
+
+	return 0
+}
+
+// LinearJitterBackoff linearly increased the backoff with jitter
+func LinearJitterBackoff(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
+	// nolint:gosec // math/rand is strong enough for this case
+	rnd := rand.New(rand.NewSource(int64(time.Now().Nanosecond())))
+	return linearJitterBackoff(rnd, min, max, attemptNum, resp)
+}
+
+// NewLinearJitterBackoff returns LinearJitterBackoff which draws the jitter from the source
+func NewLinearJitterBackoff(source rand.Source) Backoff {
+	// nolint:gosec // math/rand is strong enough for this case
+	rnd := rand.New(&lockedSource{source: source})
+	return func(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
+		return linearJitterBackoff(rnd, min, max, attemptNum, resp)
+	}
+}
+
+func linearJitterBackoff(rnd *rand.Rand, min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
+	delay := retryAfter(resp)
+	if delay > 0 {
+		return delay
+	}
+
+	jitter := jitterFraction(rnd, resp) * float64(max-min)
+	jitterMin := int64(jitter) + int64(min)
+	return time.Duration(jitterMin * int64(attemptNum))
+}
+
+// ExponentialJitterBackoff returns exponential backoff with jitter
+// seep = rand(minDelay, min(maxDelay, base * 2 ** attemptNum))
+func ExponentialJitterBackoff(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
+	// nolint:gosec // math/rand is strong enough for this case
+	rnd := rand.New(rand.NewSource(int64(time.Now().Nanosecond())))
+	return exponentialJitterBackoff(rnd, min, max, attemptNum, resp)
+}
+
+// NewExponentialJitterBackoff returns ExponentialJitterBackoff which draws the jitter from the source
+func NewExponentialJitterBackoff(source rand.Source) Backoff {
+	// nolint:gosec // math/rand is strong enough for this case
+	rnd := rand.New(&lockedSource{source: source})
+	return func(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
+		return exponentialJitterBackoff(rnd, min, max, attemptNum, resp)
+	}
+}
+
+func exponentialJitterBackoff(rnd *rand.Rand, min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
+	delay := retryAfter(resp)
+	if delay > 0 {
+		return delay
+	}
+
+	base := float64(min) * float64(attemptNum)
+	maxDelay := math.Min(float64(max), base*math.Pow(2.0, float64(attemptNum)))
+
+	if float64(min) > maxDelay { // it's unclear what to do in such case
+		maxDelay = float64(max)
+	}
+
+	jitter := jitterFraction(rnd, resp) * (maxDelay - float64(min))
+	jitterMin := int64(jitter) + int64(min)
+
+	return min + time.Duration(jitterMin)
+}
+
+// centerProbe is passed to the backoff in place of the response to get the deterministic center of its delays
+var centerProbe = &http.Response{}
+
+// jitterFraction draws the position of the delay within the jitter range, which is its middle for centerProbe
+func jitterFraction(rnd *rand.Rand, resp *http.Response) float64 {
+	if resp == centerProbe {
+		return 0.5
+	}
+
+	return rnd.Float64()
+}
+
+// FastFirstRetry makes the first retry wait just the minimum time, the later ones are delegated to the backoff
+func FastFirstRetry(backoff Backoff) Backoff {
+	return func(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
+		if attemptNum <= 1 {
+			return ConstantBackoff(min, max, attemptNum, resp)
+		}
+
+		return backoff(min, max, attemptNum, resp)
+	}
+}
+
+// FirstRetryImmediate makes the first retry go right away unless the server asks to wait by Retry-After header,
+// the later ones are delegated to the backoff
+func FirstRetryImmediate(backoff Backoff) Backoff {
+	return func(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
+		if attemptNum <= 1 {
+			return retryAfter(resp)
+		}
+
+		return backoff(min, max, attemptNum, resp)
+	}
+}
+
+// WithMaxJitter keeps the delay of the backoff within maxJitter of its deterministic center. The center of
+// the jitter backoffs is the middle of the range they draw the delay from for the attempt, so it grows along
+// with the range. Other backoffs are centered at the delay they return for a response without Retry-After
+// header. The delay asked by Retry-After header is never changed
+func WithMaxJitter(backoff Backoff, maxJitter time.Duration) Backoff {
+	return func(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
+		delay := backoff(min, max, attemptNum, resp)
+		if retryAfter(resp) > 0 {
+			return delay
+		}
+		center := backoff(min, max, attemptNum, centerProbe)
+
+		switch {
+		case delay > center+maxJitter:
+			delay = center + maxJitter
+		case delay < center-maxJitter:
+			delay = center - maxJitter
+		}
+		if delay < 0 {
+			delay = 0
+		}
+
+		return delay
+	}
+}
+
+// wait returns the channel which receives once the backoff passes
+func (c apiClient) wait(d time.Duration) <-chan time.Time {
+	if c.after != nil {
+		return c.after(d)
+	}
+
+	return time.After(d)
+}
+
+// lockedSource makes the source safe for concurrent use by the client
+type lockedSource struct {
+	mu     sync.Mutex
+	source rand.Source
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.source.Int63()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.source.Seed(seed)
+}
+
+// newJitterSource returns a random source seeded by crypto/rand, so clients started
+// at the same time across a fleet don't back off in sync
+func newJitterSource() rand.Source {
+	var seed int64
+	if err := binary.Read(crand.Reader, binary.LittleEndian, &seed); err != nil {
+		seed = time.Now().UnixNano()
+	}
+
+	// nolint:gosec // math/rand is strong enough for this case
+	return rand.NewSource(seed)
+}
+
+// ConstantBackoff always waits the minimum time
+func ConstantBackoff(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
+	delay := retryAfter(resp)
+	if delay > 0 {
+		return delay
+	}
+
+	return min
+}
+
+// NoBackoff retries immediately
+func NoBackoff(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
+	return 0
+}
+
+// Names of the backoff strategies to choose in the config
+const (
+	BackoffExponential = "exponential"
+	BackoffLinear      = "linear"
+	BackoffConstant    = "constant"
+	BackoffNone        = "none"
+)
+
+var backoffStrategies = map[string]func(source rand.Source) Backoff{
+	"":                 NewExponentialJitterBackoff,
+	BackoffExponential: NewExponentialJitterBackoff,
+	BackoffLinear:      NewLinearJitterBackoff,
+	BackoffConstant:    func(rand.Source) Backoff { return ConstantBackoff },
+	BackoffNone:        func(rand.Source) Backoff { return NoBackoff },
+}
+
+// FirstRetry defines how long to wait before the first retry, the backoff applies to the later ones
+type FirstRetry int
+
+const (
+	// FirstRetryBackoff waits before the first retry as the backoff suggests
+	FirstRetryBackoff FirstRetry = iota
+	// FirstRetryMinWait waits just RetryWaitMin before the first retry, see FastFirstRetry
+	FirstRetryMinWait
+	// FirstRetryNoWait makes the first retry right away to absorb blips, see FirstRetryImmediate
+	FirstRetryNoWait
+)
+
+// backoffByName resolves the backoff strategy falling back to the default one for unknown names
+func backoffByName(name string, source rand.Source, firstRetry FirstRetry) Backoff {
+	newBackoff, ok := backoffStrategies[name]
+	if !ok {
+		newBackoff = NewExponentialJitterBackoff
+	}
+
+	backoff := newBackoff(source)
+	switch firstRetry {
+	case FirstRetryMinWait:
+		backoff = FastFirstRetry(backoff)
+	case FirstRetryNoWait:
+		backoff = FirstRetryImmediate(backoff)
+	}
+
+	return backoff
+}
+
+// Signer is an interface of function to sign request body
+type Signer func(publicKey, secret string, body []byte) (string, error)
+
+// ContextSigner signs request body out of process, e.g. by HSM or KMS, so the secret never lives in the process.
+// It's given the context of the call to give up once the call is canceled
+type ContextSigner func(ctx context.Context, publicKey string, body []byte) (string, error)
+
+// Hmac256Signer is default request signer
+func Hmac256Signer(publicKey, secret string, body []byte) (string, error) {
+	return NewHmac256Signer(SignerOptions{})(publicKey, secret, body)
+}
+
+// SignerOptions customizes base64 encodings of the HMAC signer, nil fields keep the defaults of Hmac256Signer
+type SignerOptions struct {
+	BodyEncoding     *base64.Encoding // Encoding of the body before it's hashed, base64.RawURLEncoding by default
+	EnvelopeEncoding *base64.Encoding // Encoding of the "publicKey:hash" signature, base64.StdEncoding by default
+}
+
+// NewHmac256Signer returns the HMAC signer using the given encodings, e.g. to produce URL-safe signatures
+func NewHmac256Signer(opts SignerOptions) Signer {
+	if opts.BodyEncoding == nil {
+		opts.BodyEncoding = base64.RawURLEncoding
+	}
+	if opts.EnvelopeEncoding == nil {
+		opts.EnvelopeEncoding = base64.StdEncoding
+	}
+
+	return func(publicKey, secret string, body []byte) (string, error) {
+		mac, err := hmac256(secret, body, opts.BodyEncoding)
+		if err != nil {
+			return "", err
+		}
+
+		bodyHash := hex.EncodeToString(mac)
+		signature := fmt.Sprintf("%s:%s", publicKey, bodyHash)
+
+		return opts.EnvelopeEncoding.EncodeToString([]byte(signature)), nil
+	}
+}
+
+func hmac256(secret string, body []byte, encoding *base64.Encoding) ([]byte, error) {
+	base64body := encoding.EncodeToString(body)
+	hash := hmac.New(sha256.New, []byte(secret))
+	_, err := hash.Write([]byte(base64body))
+	if err != nil {
+		return nil, err
+	}
+
+	return hash.Sum(nil), nil
+}
+
+// VerifySignature checks the signature made by Hmac256Signer, the Authorization header value of any scheme is accepted as well
+func VerifySignature(publicKey, secret string, body []byte, signature string) (bool, error) {
+	// the signature has no spaces, so anything before the space is the auth scheme
+	if i := strings.IndexByte(signature, ' '); i >= 0 {
+		signature = signature[i+1:]
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false, fmt.Errorf("malformed signature: %w", err)
+	}
+
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return false, errors.New("malformed signature: missing body hash")
+	}
+
+	bodyHash, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return false, fmt.Errorf("malformed signature: %w", err)
+	}
+
+	expected, err := hmac256(secret, body, base64.RawURLEncoding)
+	if err != nil {
+		return false, err
+	}
+
+	keyMatches := hmac.Equal([]byte(parts[0]), []byte(publicKey))
+	hashMatches := hmac.Equal(bodyHash, expected)
+
+	return keyMatches && hashMatches, nil
+}
+
+// Call the RPC method
+func (c apiClient) Call(method string, params, result interface{}) error {
+	return c.CallWithContext(context.Background(), method, params, result)
+}
+
+// CallWithContext is the same as Call but allows to pass a context
+func (c apiClient) CallWithContext(ctx context.Context, method string, params, result interface{}) error {
+	return c.CallRequest(ctx, Request{Method: method, Params: params}, result)
+}
+
+// CallRequest calls the RPC method described by the request, the response id has to match the request one
+func (c apiClient) CallRequest(ctx context.Context, request Request, result interface{}) error {
+	return c.call(ctx, request, &rpcCall{result: result})
+}
+
+func (c apiClient) call(ctx context.Context, request Request, call *rpcCall) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// surrounding whitespace is most likely a typo, so it's trimmed
+	request.Method = strings.TrimSpace(request.Method)
+	if request.Method == "" {
+		return ErrEmptyMethod
+	}
+	request.Method = c.qualifiedMethod(request.Method)
+
+	if stubbed, err := c.serveStub(request.Method, call); stubbed {
+		c.log(ctx, DebugLevel, "serving the stub of %s", request.Method)
+		return err
+	}
+
+	if timeout, ok := c.Config.MethodTimeouts[request.Method]; ok && timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if c.breaker != nil {
+		if err := c.breaker.allow(); err != nil {
+			return err
+		}
+	}
+
+	if v, ok := request.Params.(validator); ok {
+		if err := v.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.semaphore != nil {
+		select {
+		case c.semaphore <- struct{}{}:
+			defer func() { <-c.semaphore }()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if c.stats != nil {
+		defer c.stats.begin()()
+	}
+
+	body, params, id, err := c.encodeRequest(request)
+	if err != nil {
+		return err
+	}
+
+	c.log(ctx, DebugLevel, "request body: %s", body)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint(request.Method, request.Version), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	setVersionHeader(req, request.Version)
+
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	c.setAccept(req)
+	if err = c.sign(req, body); err != nil {
+		return err
+	}
+
+	call.id = id
+	call.info = &CallInfo{Method: request.Method, ID: id.value, Metadata: MetadataFromContext(ctx)}
+	if c.envelopes != nil {
+		c.emitEnvelope(EnvelopeRequest, call, body)
+	}
+	c.teeRequest(ctx, body)
+	c.prepareCache(req, call, request.Method, params)
+
+	start := time.Now()
+
+	err = c.sendRequest(req, call)
+	if c.Config.OnUnauthorized != nil && isUnauthorized(err) {
+		err = c.retryUnauthorized(req, call, func() error { return c.sign(req, body) })
+	}
+	if c.Config.TimestampSigner != nil && isClockSkew(err) {
+		err = c.retryClockSkew(req, body, call, err)
+	}
+
+	for c.shouldRepeatCall(ctx, request.Method, err, call) {
+		if err != nil {
+			c.log(ctx, WarningLevel, "retrying %s after the error: %v", request.Method, err)
+		} else {
+			c.log(ctx, WarningLevel, "retrying %s after the empty result", request.Method)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.wait(call.retryer.Backoff(call.info.Attempts, nil)):
+		}
+
+		err = c.sendRequest(req, call)
+	}
+
+	if err != nil && c.Config.ServeStaleOnError {
+		err = c.serveStale(call, err)
+	}
+
+	call.info.Duration = time.Since(start)
+	call.info.Err = err
+	if c.Config.OnComplete != nil {
+		c.Config.OnComplete(*call.info)
+	}
+
+	return err
+}
+
+// encodeRequest encodes the request of the qualified method as it's sent: the params by the codec,
+// the id of Config.IDType, then the body made canonical and encrypted as configured
+func (c apiClient) encodeRequest(request Request) (body []byte, params json.RawMessage, id rpcID, err error) {
+	var ok bool
+	if params, ok = request.Params.(json.RawMessage); !ok {
+		if params, err = c.codec().Marshal(request.Params); err != nil {
+			return nil, nil, id, err
+		}
+	}
+
+	requestID, err := c.requestID(request.ID)
+	if err != nil {
+		return nil, nil, id, err
+	}
+
+	rpcReq := newRPCRequest(request.Method, params, requestID)
+	if rpcReq.ID, err = c.typedID(rpcReq.ID.value); err != nil {
+		return nil, nil, id, err
+	}
+	if body, err = rpcReq.marshal(); err != nil {
+		return nil, nil, id, err
+	}
+	if c.Config.CanonicalJSON {
+		if body, err = canonicalJSON(body); err != nil {
+			return nil, nil, id, err
+		}
+	}
+	if c.Config.ParamsEncryptor != nil {
+		if body, err = c.encryptParams(request.Method, body); err != nil {
+			return nil, nil, id, err
+		}
+	}
+
+	return body, params, rpcReq.ID, nil
+}
+
+// encryptParams transforms the body with Config.ParamsEncryptor making sure it's still a valid JSON
+func (c apiClient) encryptParams(method string, body []byte) ([]byte, error) {
+	encrypted, err := c.Config.ParamsEncryptor(method, body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encrypt params of %s: %w", method, err)
+	}
+
+	if !json.Valid(encrypted) {
+		return nil, fmt.Errorf("params of %s are not a valid JSON once encrypted", method)
+	}
+
+	return encrypted, nil
+}
+
+// endpoint returns the URL the method of the version is called at
+func (c apiClient) endpoint(method string, version APIVersion) string {
+	endpoint := versionedURL(c.Config.BaseURL, version)
+	if c.Config.EncodeMethodInPath {
+		endpoint = strings.TrimSuffix(endpoint, "/") + "/" + url.PathEscape(method)
+	}
+
+	return endpoint
+}
+
+// qualifiedMethod prepends Config.MethodPrefix to the method
+func (c apiClient) qualifiedMethod(method string) string {
+	if c.Config.MethodPrefix == "" || (strings.Contains(method, ".") && !c.Config.PrefixQualifiedMethods) {
+		return method
+	}
+
+	return c.Config.MethodPrefix + method
+}
+
+// checkHTTPS fails with ErrInsecureURL if Config.RequireHTTPS is set and the request isn't sent over https
+func (c apiClient) checkHTTPS(req *http.Request) error {
+	if c.Config.RequireHTTPS && isInsecureURL(req.URL) {
+		return fmt.Errorf("%w: %s", ErrInsecureURL, req.URL.Redacted())
+	}
+
+	return nil
+}
+
+// sign sets Authorization header signing the body with the current credentials
+func (c apiClient) sign(req *http.Request, body []byte) error {
+	publicKey, secret, err := c.credentials(req.Context())
+	if err != nil {
+		return err
+	}
+
+	signer := c.signer()
+	switch {
+	case c.contextSigner != nil:
+		signer = func(publicKey, _ string, body []byte) (string, error) {
+			return c.signExternally(req.Context(), publicKey, body)
+		}
+	case c.Config.TimestampSigner != nil:
+		signer = func(publicKey, secret string, body []byte) (string, error) {
+			return c.signTimestamp(req, publicKey, secret, body)
+		}
+	}
+
+	scheme := c.authScheme()
+	authorization, err := AuthorizationHeader(scheme, signer, publicKey, secret, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", authorization)
+	signature := strings.TrimPrefix(authorization, scheme+" ")
+	c.log(req.Context(), DebugLevel, "signature fingerprint: %s", signatureFingerprint(signature))
+
+	return nil
+}
+
+// authScheme returns the scheme the signature is given with in the Authorization header
+func (c apiClient) authScheme() string {
+	if c.Config.AuthScheme == "" {
+		return DefaultAuthScheme
+	}
+
+	return c.Config.AuthScheme
+}
+
+// signExternally waits for the external signer as long as the context allows. Its failure fails the call
+// without sending the request, so it's never retried
+func (c apiClient) signExternally(ctx context.Context, publicKey string, body []byte) (string, error) {
+	type signed struct {
+		signature string
+		err       error
+	}
+
+	// the channel is buffered not to leak the signer ignoring the canceled context
+	done := make(chan signed, 1)
+	started := c.goTracked(func() {
+		signature, err := c.contextSigner(ctx, publicKey, body)
+		done <- signed{signature: signature, err: err}
+	})
+	if !started {
+		return "", ErrClientClosed
+	}
+
+	select {
+	case <-ctx.Done():
+		return "", fmt.Errorf("unable to sign request: %w", ctx.Err())
+	case result := <-done:
+		if result.err != nil {
+			return "", fmt.Errorf("unable to sign request: %w", result.err)
+		}
+		return result.signature, nil
+	}
+}
+
+// setAccept sets Accept header as configured
+func (c apiClient) setAccept(req *http.Request) {
+	switch c.Config.Accept {
+	case OmitAccept:
+	case "":
+		req.Header.Set("Accept", DefaultAccept)
+	default:
+		req.Header.Set("Accept", c.Config.Accept)
+	}
+}
+
+// AuthorizationHeader returns the Authorization header value the client sends along with the body, e.g. to
+// sign requests made by custom transports. The scheme is Config.AuthScheme, DefaultAuthScheme if empty
+func AuthorizationHeader(scheme string, signer Signer, publicKey, secret string, body []byte) (string, error) {
+	if scheme == "" {
+		scheme = DefaultAuthScheme
+	}
+
+	signature, err := signer(publicKey, secret, body)
+	if err != nil {
+		return "", err
 	}
+
+	return scheme + " " + signature, nil
 }
 
-// Backoff allows to define different backoff scenarios to request retries
-type Backoff func(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration
+// signatureFingerprint returns the short hash of the signature to correlate client and server logs without exposing it
+func signatureFingerprint(signature string) string {
+	sum := sha256.Sum256([]byte(signature))
+	return hex.EncodeToString(sum[:4])
+}
 
-func retryAfter(resp *http.Response) time.Duration {
-	if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
-		if sleep, err := strconv.ParseInt(resp.Header.Get("Retry-After"), 10, 64); err == nil {
-			return time.Second * time.Duration(sleep)
-		}
+func (c apiClient) credentials(ctx context.Context) (publicKey, secret string, err error) {
+	if c.Config.Credentials != nil {
+		return c.Config.Credentials.Credentials(ctx)
 	}
 
-	return 0
+	return c.Config.publicKey, c.Config.secret, nil
 }
 
-// LinearJitterBackoff linearly increased the backoff with jitter
-func LinearJitterBackoff(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
-	delay := retryAfter(resp)
-	if delay > 0 {
-		return delay
-	}
-
-	rnd := rand.New(rand.NewSource(int64(time.Now().Nanosecond())))
-	jitter := rnd.Float64() * float64(max-min)
-	jitterMin := int64(jitter) + int64(min)
-	return time.Duration(jitterMin * int64(attemptNum))
+func isUnauthorized(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusUnauthorized
 }
 
-// ExponentialJitterBackoff returns exponential backoff with jitter
-// seep = rand(minDelay, min(maxDelay, base * 2 ** attemptNum))
-func ExponentialJitterBackoff(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
-	delay := retryAfter(resp)
-	if delay > 0 {
-		return delay
+// retryUnauthorized lets the hook refresh the credentials and repeats the request once signed with the new ones
+func (c apiClient) retryUnauthorized(req *http.Request, call *rpcCall, sign func() error) error {
+	c.log(req.Context(), WarningLevel, "refreshing credentials after 401 response to %s", call.info.Method)
+
+	if err := c.Config.OnUnauthorized(req.Context()); err != nil {
+		return fmt.Errorf("unable to refresh credentials: %w", err)
 	}
 
-	// nolint:gosec // math/rand is strong enough for this case
-	rnd := rand.New(rand.NewSource(int64(time.Now().Nanosecond())))
+	if err := sign(); err != nil {
+		return err
+	}
 
-	base := float64(min) * float64(attemptNum)
-	maxDelay := math.Min(float64(max), base*math.Pow(2.0, float64(attemptNum)))
+	return c.sendRequest(req, call)
+}
 
-	if float64(min) > maxDelay { // it's unclear what to do in such case
-		maxDelay = float64(max)
+// shouldRepeatCall decides if the whole call has to be repeated after the request has been completed
+func (c apiClient) shouldRepeatCall(ctx context.Context, method string, err error, call *rpcCall) bool {
+	return c.shouldRetryRPCError(ctx, method, err, call) || c.shouldRetryEmpty(ctx, method, err, call)
+}
+
+// shouldRetryRPCError decides if the whole call has to be repeated because of the RPC error
+func (c apiClient) shouldRetryRPCError(ctx context.Context, method string, err error, call *rpcCall) bool {
+	var rpcErr *RPCError
+	if c.Config.RetryableRPCError == nil || !errors.As(err, &rpcErr) {
+		return false
 	}
 
-	jitter := rnd.Float64() * (maxDelay - float64(min))
-	jitterMin := int64(jitter) + int64(min)
+	return !c.isNonRetryable(method) && c.Config.RetryableRPCError(rpcErr) && c.retryerAllows(ctx, call, err)
+}
 
-	return min + time.Duration(jitterMin)
+// shouldRetryEmpty decides if the call has to be repeated because its result is not available yet
+func (c apiClient) shouldRetryEmpty(ctx context.Context, method string, err error, call *rpcCall) bool {
+	if c.Config.RetryWhileEmpty == nil || err != nil || call.stream != nil {
+		return false
+	}
+
+	return !c.isNonRetryable(method) && c.Config.RetryWhileEmpty(call.result) &&
+		c.retryerAllows(ctx, call, fmt.Errorf("%w: the result is empty", ErrRetryableResponse))
 }
 
-// Signer is an interface of function to sign request body
-type Signer func(publicKey, secret string, body []byte) (string, error)
+// retryerAllows lets the retryer of the call limit the repeated requests, the attempts of all of them count
+func (c apiClient) retryerAllows(ctx context.Context, call *rpcCall, err error) bool {
+	shouldRetry, _ := call.retryer.ShouldRetry(ctx, nil, call.info.Attempts, err)
+	return shouldRetry
+}
 
-// Hmac256Signer is default request signer
-func Hmac256Signer(publicKey, secret string, body []byte) (string, error) {
-	base64body := base64.RawURLEncoding.EncodeToString(body)
-	hash := hmac.New(sha256.New, []byte(secret))
-	_, err := hash.Write([]byte(base64body))
-	if err != nil {
-		return "", err
+// connectionTrace logs the connection events of the attempt enabled by WithHTTPTrace
+func (c apiClient) connectionTrace(ctx context.Context, attempt int) *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			c.log(ctx, DebugLevel, "attempt %d: got connection to %s: reused: %t, was idle: %t, idle time: %s",
+				attempt, info.Conn.RemoteAddr(), info.Reused, info.WasIdle, info.IdleTime)
+		},
+		PutIdleConn: func(err error) {
+			if err != nil {
+				c.log(ctx, DebugLevel, "attempt %d: connection is not reused: %v", attempt, err)
+				return
+			}
+			c.log(ctx, DebugLevel, "attempt %d: connection is returned to the pool", attempt)
+		},
 	}
+}
 
-	bodyHash := hex.EncodeToString(hash.Sum(nil))
-	signature := fmt.Sprintf("%s:%s", publicKey, bodyHash)
+// injectFault returns the transport error simulated by Config.FaultInjector, nil to send the request
+func (c apiClient) injectFault(attempt int) error {
+	if c.Config.FaultInjector == nil {
+		return nil
+	}
 
-	return base64.StdEncoding.EncodeToString([]byte(signature)), nil
+	return c.Config.FaultInjector(attempt)
 }
 
-// Call the RPC method
-func (c apiClient) Call(method string, params, result interface{}) error {
-	return c.CallWithContext(context.Background(), method, params, result)
+// isStaleConnError tells if the request has failed because the server has closed the idle connection
+func isStaleConnError(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		strings.Contains(err.Error(), "server closed idle connection")
 }
 
-// CallWithContext is the same as Call but allows to pass a context
-func (c apiClient) CallWithContext(ctx context.Context, method string, params, result interface{}) error {
-	rpcReq := newRPCRequest(method, params, "1")
-	body, err := json.Marshal(rpcReq)
+// bodyMatchLimit is the maximum number of bytes of the response body given to Config.RetryOnBodyMatch
+const bodyMatchLimit = 64 << 10
 
-	c.log(DebugLevel, "request body: %s", body)
-
-	if err != nil {
-		return err
+// vetoSuccess lets Config.RetryOnBodyMatch and Config.SuccessPredicate reject the successful response,
+// the body is kept to be decoded
+func (c apiClient) vetoSuccess(resp *http.Response) error {
+	if (resp.StatusCode < 200 || resp.StatusCode >= 300) && !c.isExtraSuccessStatus(resp.StatusCode) {
+		return nil
 	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Config.BaseURL, bytes.NewReader(body))
-	if err != nil {
-		return err
+
+	if c.Config.RetryOnBodyMatch != nil {
+		peeked, replay, err := peekBody(resp.Body, bodyMatchLimit)
+		resp.Body = replay
+		if err != nil {
+			return err
+		}
+		if c.Config.RetryOnBodyMatch(peeked) {
+			return fmt.Errorf("%w: the body matched RetryOnBodyMatch", ErrRetryableResponse)
+		}
 	}
 
-	signer := c.RequestSigner
-	if signer == nil {
-		signer = defaultRequestSigner
+	if c.Config.SuccessPredicate == nil {
+		return nil
 	}
 
-	signature, err := signer(c.Config.publicKey, c.Config.secret, body)
+	body, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
 	if err != nil {
 		return err
 	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
 
-	req.Header.Set("Content-Type", "application/json; charset=utf-8")
-	req.Header.Set("Accept", "application/json; charset=utf-8")
-	req.Header.Set("Authorization", "Basic "+signature)
+	return c.Config.SuccessPredicate(resp, body)
+}
 
-	err = c.sendRequest(req, result)
-	if err != nil {
-		return err
+// isExtraSuccessStatus tells if the status out of 2xx range is configured as success by Config.SuccessStatusCodes
+func (c apiClient) isExtraSuccessStatus(status int) bool {
+	for _, code := range c.Config.SuccessStatusCodes {
+		if code == status {
+			return true
+		}
 	}
 
-	return nil
+	return false
 }
 
-func (c *apiClient) sendRequest(req *http.Request, v interface{}) error {
+// isNonRetryable tells if the method must be attempted just once, e.g. the one creating a payment
+func (c apiClient) isNonRetryable(method string) bool {
+	for _, m := range c.Config.NonRetryableMethods {
+		if m == method {
+			return true
+		}
+	}
+
+	return false
+}
+
+// rpcCall holds the state of a single call shared by all of its attempts
+type rpcCall struct {
+	id       rpcID
+	result   interface{}
+	stream   func(item json.RawMessage) error // set to stream the result array item by item
+	batch    []*BatchCall                     // set to match the batch responses to the calls
+	info     *CallInfo
+	cacheKey string // empty if the result is not cacheable
+	cached   []byte // cached result to serve on 304 Not Modified
+	// Date header of the last response to correct the clock skew
+	serverDate string
+	// retryer of the call, it's kept across the repeated requests of the call
+	retryer RequestRetryer
+}
+
+func (c *apiClient) sendRequest(req *http.Request, call *rpcCall) error {
+	info := call.info
 	var attempt int
 	var resp *http.Response
 	var doErr, checkErr error
 	var shouldRetry bool
+	var history []AttemptRecord
+	var attemptStart time.Time
+	var reusedConn, staleConnResent bool
+	var wroteHeaders int32 // set by the write loop of the transport
+	var releaseConn func()
+
+	if err := c.checkHTTPS(req); err != nil {
+		return err
+	}
 
-	retry := c.RequestBackoff
-	if retry == nil {
-		retry = defaultRequestBackoff
+	ctx := req.Context()
+	if call.retryer == nil {
+		call.retryer = c.retryer(ctx)
 	}
+	retryer := call.retryer
 
 	for {
 		attempt++
+		info.Attempts++ // the attempts of the repeated requests of the call add up
+		info.TimeToFirstByte = 0
+
+		attemptStart = time.Now()
+		traceCtx := ctx
+		if httpTraceEnabled(ctx) {
+			traceCtx = httptrace.WithClientTrace(traceCtx, c.connectionTrace(ctx, attempt))
+		}
+		reusedConn = false
+		atomic.StoreInt32(&wroteHeaders, 0)
+		releaseConn = func() {}
+		req = req.WithContext(httptrace.WithClientTrace(traceCtx, &httptrace.ClientTrace{
+			GotConn: func(conn httptrace.GotConnInfo) {
+				reusedConn = conn.Reused
+				if c.pool != nil {
+					releaseConn = c.pool.acquire()
+				}
+			},
+			WroteHeaders: func() {
+				atomic.StoreInt32(&wroteHeaders, 1)
+			},
+			GotFirstResponseByte: func() {
+				info.TimeToFirstByte = time.Since(attemptStart)
+			},
+		}))
+
+		// every attempt has to send the body from the start
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return err
+			}
+			req.Body = body
+		}
+
+		setDeadlineHeader(req, c.Config.DeadlineFormat)
+		if c.Config.AttemptHeader != "" {
+			req.Header.Set(c.Config.AttemptHeader, strconv.Itoa(attempt))
+		}
 
-		if req.Body != nil {
-			body := req.Body
-			if c, ok := body.(io.ReadCloser); ok {
-				req.Body = c
-			} else {
-				req.Body = ioutil.NopCloser(body)
+		resp, doErr = nil, c.injectFault(attempt)
+		if doErr == nil {
+			resp, doErr = c.HTTPClient.Do(req)
+		}
+		if doErr != nil {
+			releaseConn()
+		} else if c.pool != nil {
+			resp.Body = &releasingBody{ReadCloser: resp.Body, release: releaseConn}
+		}
+		if resp != nil {
+			info.StatusCode = resp.StatusCode
+			call.serverDate = resp.Header.Get("Date")
+			c.warnVersionMismatch(ctx, info.Method, req, resp)
+
+			// the hooks below and the decoder read the body decompressed and limited once for all
+			body, bodyErr := c.responseBody(resp)
+			if bodyErr != nil {
+				resp.Body.Close()
+				return bodyErr
+			}
+			resp.Body = body
+		}
+		if c.Config.AuditHook != nil {
+			if err := c.audit(req, info.Method, attempt, resp, doErr); err != nil {
+				if resp != nil {
+					resp.Body.Close()
+				}
+				return err
+			}
+		}
+
+		if c.har != nil {
+			if err := c.har.write(req, resp, attemptStart, doErr); err != nil {
+				c.log(ctx, ErrorLevel, "unable to write HAR entry: %v", err)
 			}
 		}
 
-		resp, doErr = c.HTTPClient.Do(req)
-		shouldRetry, checkErr = checkRetry(req.Context(), resp, c.Config.RetryMax, attempt, doErr)
+		// the request hasn't reached the server if it has closed the pooled connection before anything was written,
+		// so it's sent once again over a new connection whatever the retry settings are
+		if doErr != nil && reusedConn && atomic.LoadInt32(&wroteHeaders) == 0 && !staleConnResent && isStaleConnError(doErr) {
+			c.log(ctx, WarningLevel, "resending %s over a new connection, the pooled one was closed: %v", info.Method, doErr)
+			staleConnResent = true
+			attempt--
+			info.Attempts--
+			continue
+		}
+
+		shouldRetry, checkErr = retryer.ShouldRetry(req.Context(), resp, attempt, doErr)
+		if doErr == nil && c.isExtraSuccessStatus(resp.StatusCode) {
+			shouldRetry, checkErr = false, nil
+		}
+		if doErr == nil && checkErr == nil && !shouldRetry && (c.Config.SuccessPredicate != nil || c.Config.RetryOnBodyMatch != nil) {
+			if vetoErr := c.vetoSuccess(resp); vetoErr != nil {
+				shouldRetry, checkErr = false, vetoErr
+				if errors.Is(vetoErr, ErrRetryableResponse) {
+					// the vetoed response counts as a failed attempt, so the retry limits apply
+					shouldRetry, checkErr = retryer.ShouldRetry(req.Context(), nil, attempt, vetoErr)
+				}
+			}
+		}
+		if shouldRetry && c.isNonRetryable(info.Method) {
+			shouldRetry = false
+		}
+		history = recordAttempt(history, attempt, attemptStart, resp, doErr, checkErr)
+		if c.breaker != nil {
+			c.breaker.record(resp, doErr)
+		}
+		if c.stats != nil {
+			c.stats.record(resp, doErr)
+		}
 
 		if doErr != nil {
-			c.log(ErrorLevel, "%s %s request failed: %v", req.Method, req.URL, doErr)
+			c.log(ctx, ErrorLevel, "%s %s request failed: %v", req.Method, req.URL, doErr)
 		}
 
 		if !shouldRetry {
 			break
 		}
 
+		wait := c.clampRetryAfter(ctx, info.Method, resp, retryer.Backoff(attempt, resp))
+		if delay := c.limitRetryAfter(retryAfterHeader(resp)); c.Config.FailOnRetryAfterDeadline && delay > 0 && !fitsDeadline(ctx, delay) {
+			c.drainBody(ctx, resp.Body)
+			return fmt.Errorf("%w: asked to wait %s", ErrRetryAfterExceedsDeadline, delay)
+		}
+		if c.Config.RetryUntilDeadline && !fitsDeadline(ctx, wait) {
+			c.log(ctx, WarningLevel, "giving up %s, the next attempt in %s would miss the deadline", info.Method, wait)
+			shouldRetry = false
+			if doErr == nil && checkErr == nil {
+				checkErr = context.DeadlineExceeded
+			}
+			break
+		}
+
 		// consume any response to reuse the connection.
 		if doErr == nil {
-			c.drainBody(resp.Body)
+			c.drainBody(ctx, resp.Body)
+		}
+
+		var stopped <-chan struct{} // nil channel blocks forever if there is no breaker
+		if c.breaker != nil {
+			stopped = c.breaker.stopped()
 		}
 
-		wait := retry(c.Config.RetryWaitMin, c.Config.RetryWaitMax, attempt, resp)
 		select {
 		case <-req.Context().Done():
 			c.HTTPClient.CloseIdleConnections()
 			return req.Context().Err()
-		case <-time.After(wait):
+		case <-stopped:
+			return ErrCircuitOpen
+		case <-c.wait(wait):
 		}
 
 		httpreq := *req
 		req = &httpreq
 	}
 
+	if doErr == nil && resp.StatusCode == http.StatusNotModified && call.cached != nil {
+		c.drainBody(ctx, resp.Body)
+		return c.codec().Unmarshal(call.cached, call.result)
+	}
+
 	if doErr == nil && checkErr == nil && !shouldRetry {
-		rpcResponse := &rpcResponse{
-			Result: v,
-			Error:  nil,
+		resp.Body = c.teeResponse(resp.Body)
+
+		// the decoder stops at the end of the JSON value, so the rest of the body, e.g. the last chunk
+		// of the chunked response, has to be read for the connection to be reused
+		defer c.drainBody(ctx, resp.Body)
+
+		decoded := resp.Body
+		var err error
+		if c.envelopes != nil {
+			if decoded, err = c.emitResponseEnvelope(call, decoded); err != nil {
+				return err
+			}
+		}
+
+		peeked, replay, err := peekBody(decoded, peekBodyLimit)
+		if err != nil {
+			return err
+		}
+		c.log(ctx, DebugLevel, "response body: %s", peeked)
+
+		body := &countingReader{reader: &depthLimitReader{reader: replay, scanner: depthScanner{max: c.maxResponseDepth()}}}
+		defer func() { info.ResponseBytes = body.count }()
+
+		if call.stream != nil {
+			return c.decodeStream(body, call)
 		}
-		err := json.NewDecoder(resp.Body).Decode(rpcResponse)
+
+		if call.batch != nil {
+			return c.decodeBatch(body, call.batch)
+		}
+
+		rpcResponse := &rpcResponse{}
+		err = json.NewDecoder(body).Decode(rpcResponse)
 		if err != nil {
 			return err
 		}
 
+		if c.Config.RequireJSONRPCField && rpcResponse.JSONRPC == "" {
+			return errors.New("response is missing jsonrpc member")
+		}
+
 		if rpcResponse.Error != nil {
-			return fmt.Errorf("%s (%d)", rpcResponse.Error.Message, rpcResponse.Error.Code)
+			if c.Config.DecodeResultWithError && len(rpcResponse.Result) > 0 {
+				// the partial result is best effort, the RPC error is what the call has failed with
+				_ = c.codec().Unmarshal(rpcResponse.Result, call.result)
+			}
+			return rpcResponse.Error
+		}
+
+		if rpcResponse.ID.value != "" && !rpcResponse.ID.matches(call.id) {
+			return fmt.Errorf("response id %s doesn't match request id %s", rpcResponse.ID, call.id)
+		}
+
+		c.storeCache(resp, call, rpcResponse.Result)
+
+		result := rpcResponse.Result
+		if c.Config.UnwrapDoubleEncodedResult {
+			result = unwrapDoubleEncoded(result)
+			// the unwrapped result has been a string, so its nesting hasn't been checked yet
+			if err = (&depthScanner{max: c.maxResponseDepth()}).scan(result); err != nil {
+				return err
+			}
+		}
+
+		if len(result) > 0 {
+			return c.codec().Unmarshal(result, call.result)
 		}
 
 		return nil
@@ -243,23 +1301,142 @@ func (c *apiClient) sendRequest(req *http.Request, v interface{}) error {
 	}
 
 	if resp != nil {
-		c.drainBody(resp.Body)
+		c.drainBody(ctx, resp.Body)
+	}
+
+	return &RetryError{
+		Attempts: attempt,
+		History:  history,
+		Err:      err,
+	}
+}
+
+// maxAttemptHistory limits the number of attempts kept in RetryError
+const maxAttemptHistory = 10
+
+// AttemptRecord describes a single attempt of the call
+type AttemptRecord struct {
+	Attempt    int
+	StatusCode int // zero if there was no response
+	Duration   time.Duration
+	Err        error
+}
+
+// RetryError is returned when the call has failed after all attempts
+type RetryError struct {
+	Attempts int
+	History  []AttemptRecord // The most recent attempts, up to 10
+	Err      error
+}
+
+func (e *RetryError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("giving up after %d attempt(s)", e.Attempts)
+	}
+
+	return fmt.Sprintf("request failed after %d attempts: %v", e.Attempts, e.Err)
+}
+
+// Unwrap returns the error of the last attempt
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+func recordAttempt(history []AttemptRecord, attempt int, start time.Time, resp *http.Response, doErr, checkErr error) []AttemptRecord {
+	record := AttemptRecord{
+		Attempt:  attempt,
+		Duration: time.Since(start),
+		Err:      doErr,
+	}
+	if resp != nil {
+		record.StatusCode = resp.StatusCode
+	}
+	if record.Err == nil {
+		record.Err = checkErr
+	}
+
+	if len(history) >= maxAttemptHistory {
+		history = history[1:]
+	}
+
+	return append(history, record)
+}
+
+// CallInfo describes the completed call
+type CallInfo struct {
+	Method          string
+	ID              string            // Request id as sent, e.g. the generated one, empty for batches
+	Attempts        int               // Number of attempts made
+	StatusCode      int               // HTTP status of the last attempt, zero if there was no response
+	Duration        time.Duration     // Total duration of the call including retries
+	TimeToFirstByte time.Duration     // Time to the first response byte of the last attempt
+	ResponseBytes   int64             // Size of the decoded response body
+	Metadata        map[string]string // Set by WithMetadata
+	Err             error
+}
+
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
+
+// DeadlineFormat defines how the context deadline is propagated to the server
+type DeadlineFormat int
+
+const (
+	// DeadlineRFC3339 sends the deadline as RFC3339 timestamp in UTC
+	DeadlineRFC3339 DeadlineFormat = iota
+	// DeadlineRemainingMs sends the number of milliseconds left until the deadline
+	DeadlineRemainingMs
+)
+
+// setDeadlineHeader sets X-Request-Deadline header if the request context has a deadline
+func setDeadlineHeader(req *http.Request, format DeadlineFormat) {
+	deadline, ok := req.Context().Deadline()
+	if !ok {
+		req.Header.Del("X-Request-Deadline")
+		return
+	}
+
+	if format == DeadlineRemainingMs {
+		req.Header.Set("X-Request-Deadline", strconv.FormatInt(time.Until(deadline).Milliseconds(), 10))
+		return
 	}
 
-	if err == nil {
-		return fmt.Errorf("%s %s giving up after %d attempt(s)", req.Method, req.URL, attempt)
+	req.Header.Set("X-Request-Deadline", deadline.UTC().Format(time.RFC3339Nano))
+}
+
+// StatusError is returned when the server responds with unexpected HTTP status
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func newStatusError(resp *http.Response) *StatusError {
+	return &StatusError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
 	}
+}
 
-	return fmt.Errorf("request failed after %d attempts: %w", attempt, err)
+func (e *StatusError) Error() string {
+	return e.Status
 }
 
+// checkRetry applies the retry policy allowing up to retryMax retries after the first attempt
 func checkRetry(ctx context.Context, resp *http.Response, retryMax, attemptNum int, err error) (bool, error) {
 	if ctx.Err() != nil {
 		return false, ctx.Err()
 	}
 
 	shouldRetry, err := retryPolicy(resp, err)
-	if attemptNum >= retryMax {
+	if attemptNum > retryMax {
 		return false, err
 	}
 
@@ -283,52 +1460,234 @@ func retryPolicy(resp *http.Response, err error) (bool, error) {
 			}
 		}
 
+		// Retry temporary resolver failures, but not the host which doesn't exist
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) {
+			if dnsErr.IsNotFound && !dnsErr.IsTemporary {
+				return false, err
+			}
+
+			return true, err
+		}
+
 		return true, err
 	}
 
 	// consider error codes of range 500 as recoverable
 	if resp.StatusCode == 0 || (resp.StatusCode >= 500 && resp.StatusCode != 501) {
-		return true, errors.New(resp.Status)
+		return true, newStatusError(resp)
 	}
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return false, errors.New(resp.Status)
+		return false, newStatusError(resp)
 	}
 
 	return false, nil
 }
 
-func (c apiClient) drainBody(body io.ReadCloser) {
+// drainBodyLimit is the maximum number of bytes of the unused response body to read
+// for the connection to be reused, longer bodies are rather closed
+const drainBodyLimit = 4096
+
+// drainBody reads the rest of the body and closes it
+func (c apiClient) drainBody(ctx context.Context, body io.ReadCloser) {
 	defer body.Close()
-	_, err := io.Copy(ioutil.Discard, io.LimitReader(body, int64(4096)))
+	n, err := io.Copy(ioutil.Discard, io.LimitReader(body, drainBodyLimit+1))
+	if err != nil {
+		c.log(ctx, ErrorLevel, "error reading response body: %v", err)
+		return
+	}
+
+	// the transport closes the connection instead of reusing it if the body is closed unread
+	if n > drainBodyLimit {
+		c.log(ctx, DebugLevel, "response body exceeds %d bytes left to drain, the connection is closed", drainBodyLimit)
+	}
+}
+
+// unwrapDoubleEncoded returns the JSON object or array encoded into the JSON string.
+// Only one level is unwrapped, anything else is returned as is
+func unwrapDoubleEncoded(result json.RawMessage) json.RawMessage {
+	if len(result) == 0 || result[0] != '"' {
+		return result
+	}
+
+	var encoded string
+	if err := json.Unmarshal(result, &encoded); err != nil {
+		return result
+	}
+
+	inner := bytes.TrimSpace([]byte(encoded))
+	if len(inner) == 0 || (inner[0] != '{' && inner[0] != '[') || !json.Valid(inner) {
+		return result
+	}
+
+	return inner
+}
+
+// peekBodyLimit is the maximum number of bytes of the response body to inspect
+const peekBodyLimit = 4096
+
+// peekBody reads up to limit bytes of the body and returns them along with
+// the body which replays the read bytes followed by the rest of the original one
+func peekBody(body io.ReadCloser, limit int64) ([]byte, io.ReadCloser, error) {
+	peeked, err := ioutil.ReadAll(io.LimitReader(body, limit))
 	if err != nil {
-		c.log(ErrorLevel, "error reading response body: %v", err)
+		return nil, body, err
+	}
+
+	return peeked, &replayBody{
+		Reader: io.MultiReader(bytes.NewReader(peeked), body),
+		Closer: body,
+	}, nil
+}
+
+type replayBody struct {
+	io.Reader
+	io.Closer
+}
+
+func (c apiClient) retryer(ctx context.Context) RequestRetryer {
+	if c.Config.NewRetryer != nil {
+		return c.Config.NewRetryer()
+	}
+	if c.Config.Retryer != nil {
+		return c.Config.Retryer
+	}
+
+	retryMax := c.Config.RetryMax
+	if _, ok := ctx.Deadline(); ok && c.Config.RetryUntilDeadline {
+		retryMax = math.MaxInt32 // the deadline limits the attempts instead
+	}
+
+	return NewDefaultRetryer(retryMax, c.Config.RetryWaitMin, c.Config.RetryWaitMax, c.RequestBackoff)
+}
+
+// clampRetryAfter limits the wait the server has asked for by Retry-After header to Config.MaxRetryAfter,
+// so a buggy or malicious server can't make the client sleep for days. It's applied by sendRequest to
+// the wait of the call only, so the retryers and PreviewBackoff keep returning the delays as asked
+func (c apiClient) clampRetryAfter(ctx context.Context, method string, resp *http.Response, wait time.Duration) time.Duration {
+	delay := retryAfterHeader(resp)
+	limit := c.limitRetryAfter(delay)
+
+	// the wait is clamped only if the backoff has honored the header, its own delays are kept as they are
+	if delay <= limit || wait < delay {
+		return wait
+	}
+
+	c.log(ctx, WarningLevel, "%s is asked to wait %s by Retry-After, waiting %s instead", method, wait, limit)
+
+	return limit
+}
+
+// limitRetryAfter returns the delay asked by Retry-After header limited to Config.MaxRetryAfter
+func (c apiClient) limitRetryAfter(delay time.Duration) time.Duration {
+	limit := c.Config.MaxRetryAfter
+	if limit <= 0 {
+		limit = c.Config.RetryWaitMax
+	}
+	if limit <= 0 {
+		limit = defaultRetryWaitMax
+	}
+
+	if delay > limit {
+		return limit
+	}
+
+	return delay
+}
+
+// fitsDeadline tells if there is time left for another attempt after the wait
+func fitsDeadline(ctx context.Context, wait time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	return !ok || time.Now().Add(wait).Before(deadline)
+}
+
+func (c apiClient) signer() Signer {
+	if c.RequestSigner != nil {
+		return c.RequestSigner
+	}
+
+	return defaultRequestSigner
+}
+
+func (c apiClient) codec() Codec {
+	if c.Config.Codec != nil {
+		return c.Config.Codec
 	}
+
+	return defaultCodec
 }
 
-func (c apiClient) log(level LogLevel, format string, args ...interface{}) {
-	if c.Config.Logger != nil {
-		c.Config.Logger.Logf(level, format, args...)
+func (c apiClient) log(ctx context.Context, level LogLevel, format string, args ...interface{}) {
+	if c.Config.Logger == nil {
+		return
+	}
+
+	if id, ok := CorrelationIDFromContext(ctx); ok {
+		format = "[" + strings.ReplaceAll(id, "%", "%%") + "] " + format
+	}
+	if metadata := MetadataFromContext(ctx); len(metadata) > 0 {
+		format += " {" + strings.ReplaceAll(formatMetadata(metadata), "%", "%%") + "}"
 	}
+	c.Config.Logger.Logf(level, format, args...)
 }
 
 type rpcRequest struct {
 	JSONRPC string      `json:"jsonrpc"`
 	Method  string      `json:"method"`
+	ID      rpcID       `json:"id"`
 	Params  interface{} `json:"params"`
-	ID      string      `json:"id"`
 }
 
 type rpcResponse struct {
-	JSONRPC string      `json:"jsonrpc"`
-	Result  interface{} `json:"result,omitempty"`
-	Error   *rpcError   `json:"error,omitempty"`
-	ID      string      `json:"id"`
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+	ID      rpcID           `json:"id"`
+}
+
+// RPCError is the error returned by the API method
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Message, e.Code)
 }
 
-type rpcError struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+// marshal encodes the request into the body owned by the caller, as the transport may read it even after
+// the call is completed. Params given as json.RawMessage are spliced into the body as is, without being re-encoded
+func (r *rpcRequest) marshal() ([]byte, error) {
+	raw, isRaw := r.Params.(json.RawMessage)
+	if !isRaw {
+		return json.Marshal(r)
+	}
+	if !json.Valid(raw) {
+		return nil, errors.New("params is not a valid JSON")
+	}
+
+	head, err := json.Marshal(struct {
+		JSONRPC string `json:"jsonrpc"`
+		Method  string `json:"method"`
+		ID      rpcID  `json:"id"`
+	}{
+		JSONRPC: r.JSONRPC,
+		Method:  r.Method,
+		ID:      r.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	const paramsMember = `,"params":`
+	body := make([]byte, 0, len(head)+len(paramsMember)+len(raw))
+	body = append(body, head[:len(head)-1]...) // without the closing brace
+	body = append(body, paramsMember...)
+	body = append(body, raw...)
+
+	return append(body, '}'), nil
 }
 
 func newRPCRequest(method string, params interface{}, id string) *rpcRequest {
@@ -339,6 +1698,6 @@ func newRPCRequest(method string, params interface{}, id string) *rpcRequest {
 		JSONRPC: "2.0",
 		Method:  method,
 		Params:  params,
-		ID:      id,
+		ID:      rpcID{value: id},
 	}
 }
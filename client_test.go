@@ -1,18 +1,38 @@
 package client
 
 import (
+	"context"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/http/httptrace"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
 func testServer(resp string) *httptest.Server {
 	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
 		_, _ = rw.Write([]byte(resp))
@@ -26,6 +46,106 @@ func TestHmac256Signer(t *testing.T) {
 	assert.Equal(t, "cHVibGljIGtleToyYTcyOTc1ZTIxZDgzZmRjZGY3Y2U1ZDY2ZGMzOTBlM2MzZWEwMGI3MjJlOTAzNmI5YTlhNjFkZDljMjIyNzk4", signature)
 }
 
+func TestAuthorizationHeader(t *testing.T) {
+	var body []byte
+	var sent string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ = ioutil.ReadAll(req.Body)
+		sent = req.Header.Get("Authorization")
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {},"id": "1"}`))
+	}))
+	defer server.Close()
+
+	config := NewConfig("public", "secret")
+	config.BaseURL = server.URL
+	err := New(config).Call("any.method", struct{}{}, &struct{}{})
+	assert.NoError(t, err)
+
+	authorization, err := AuthorizationHeader("", Hmac256Signer, "public", "secret", body)
+
+	assert.NoError(t, err)
+	assert.Equal(t, sent, authorization)
+
+	config.AuthScheme = "HMAC"
+	err = New(config).Call("any.method", struct{}{}, &struct{}{})
+	assert.NoError(t, err)
+
+	authorization, err = AuthorizationHeader(config.AuthScheme, Hmac256Signer, "public", "secret", body)
+
+	assert.NoError(t, err)
+	assert.Equal(t, sent, authorization)
+}
+
+func TestClient_Call_AuthScheme(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		authorization = req.Header.Get("Authorization")
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {},"id": "1"}`))
+	}))
+	defer server.Close()
+
+	config := NewConfig("public", "secret")
+	config.BaseURL = server.URL
+
+	assert.NoError(t, New(config).Call("any.method", struct{}{}, &struct{}{}))
+	assert.True(t, strings.HasPrefix(authorization, "Basic "), authorization)
+
+	config.AuthScheme = "Signature"
+	assert.NoError(t, New(config).Call("any.method", struct{}{}, &struct{}{}))
+	assert.True(t, strings.HasPrefix(authorization, "Signature "), authorization)
+}
+
+func TestNewHmac256Signer_URLSafeEnvelope(t *testing.T) {
+	signer := NewHmac256Signer(SignerOptions{EnvelopeEncoding: base64.URLEncoding})
+
+	urlSafe, err := signer("~~~", "secret", []byte("{}"))
+	assert.NoError(t, err)
+	standard, err := Hmac256Signer("~~~", "secret", []byte("{}"))
+	assert.NoError(t, err)
+
+	assert.NotEqual(t, standard, urlSafe)
+	assert.NotContains(t, urlSafe, "+")
+	assert.Equal(t, strings.NewReplacer("+", "-", "/", "_").Replace(standard), urlSafe)
+}
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte(`{"jsonrpc":"2.0"}`)
+	signature, err := Hmac256Signer("public key", "secret", body)
+	assert.NoError(t, err)
+
+	valid, err := VerifySignature("public key", "secret", body, signature)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	valid, err = VerifySignature("public key", "secret", body, "Basic "+signature)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	valid, err = VerifySignature("public key", "secret", body, "Signature "+signature)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	valid, err = VerifySignature("public key", "secret", []byte(`{"jsonrpc":"1.0"}`), signature)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+
+	tampered, err := Hmac256Signer("public key", "another secret", body)
+	assert.NoError(t, err)
+	valid, err = VerifySignature("public key", "secret", body, tampered)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+}
+
+func TestVerifySignature_Malformed(t *testing.T) {
+	valid, err := VerifySignature("public key", "secret", []byte("{}"), "not a base64!")
+	assert.Error(t, err)
+	assert.False(t, valid)
+
+	valid, err = VerifySignature("public key", "secret", []byte("{}"), "cHVibGljIGtleQ==")
+	assert.EqualError(t, err, "malformed signature: missing body hash")
+	assert.False(t, valid)
+}
+
 func TestClient_Call_RequestHeaders(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
 		assert.Equal(t, "application/json; charset=utf-8", req.Header.Get("Accept"))
@@ -45,6 +165,265 @@ func TestClient_Call_RequestHeaders(t *testing.T) {
 	err := client.Call("any.method", &struct{}{}, &struct{}{})
 	assert.NoError(t, err)
 }
+
+func TestClient_Call_Accept(t *testing.T) {
+	var accept []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		accept = req.Header.Values("Accept")
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {},"id": "1"}`))
+	}))
+	defer server.Close()
+
+	call := func(value string) []string {
+		client := apiClient{HTTPClient: server.Client(), Config: &Config{BaseURL: server.URL, Accept: value}}
+		assert.NoError(t, client.Call("any.method", struct{}{}, &struct{}{}))
+		return accept
+	}
+
+	assert.Equal(t, []string{DefaultAccept}, call(""))
+	assert.Equal(t, []string{"application/json"}, call("application/json"))
+	assert.Empty(t, call(OmitAccept))
+}
+
+func TestClient_Call_ParamsEncryptor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, err := ioutil.ReadAll(req.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"id":"1","jsonrpc":"2.0","method":"card.store","params":{"holder":"J. Doe","number":"NDExMTExMTExMTExMTExMQ=="}}`,
+			string(body))
+
+		valid, err := VerifySignature("public", "secret", body, req.Header.Get("Authorization"))
+		assert.NoError(t, err)
+		assert.True(t, valid, "the encrypted body is signed")
+
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {},"id": "1"}`))
+	}))
+	defer server.Close()
+
+	config := NewConfig("public", "secret")
+	config.BaseURL = server.URL
+	config.ParamsEncryptor = func(method string, body []byte) ([]byte, error) {
+		var request struct {
+			ID      string            `json:"id"`
+			JSONRPC string            `json:"jsonrpc"`
+			Method  string            `json:"method"`
+			Params  map[string]string `json:"params"`
+		}
+		if err := json.Unmarshal(body, &request); err != nil {
+			return nil, err
+		}
+		request.Params["number"] = base64.StdEncoding.EncodeToString([]byte(request.Params["number"]))
+		return json.Marshal(request)
+	}
+	client := apiClient{HTTPClient: server.Client(), Config: config}
+
+	err := client.Call("card.store", map[string]string{"number": "4111111111111111", "holder": "J. Doe"}, &struct{}{})
+	assert.NoError(t, err)
+}
+
+func TestClient_Call_ParamsEncryptorInvalidJSON(t *testing.T) {
+	client := apiClient{Config: &Config{
+		ParamsEncryptor: func(method string, body []byte) ([]byte, error) {
+			return []byte("encrypted"), nil
+		},
+	}}
+
+	err := client.Call("card.store", struct{}{}, &struct{}{})
+	assert.EqualError(t, err, "params of card.store are not a valid JSON once encrypted")
+}
+
+func TestClient_Call_MethodPrefix(t *testing.T) {
+	var method string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var request struct{ Method string }
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(&request))
+		method = request.Method
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {},"id": "1"}`))
+	}))
+	defer server.Close()
+
+	config := &Config{BaseURL: server.URL, MethodPrefix: "merchant."}
+	client := apiClient{HTTPClient: server.Client(), Config: config}
+	call := func(name string) string {
+		assert.NoError(t, client.Call(name, struct{}{}, &struct{}{}))
+		return method
+	}
+
+	assert.Equal(t, "merchant.GetDetails", call("GetDetails"))
+	assert.Equal(t, "transaction.getDetails", call("transaction.getDetails"), "qualified method is left intact")
+
+	config.PrefixQualifiedMethods = true
+	assert.Equal(t, "merchant.shop.getDetails", call("shop.getDetails"))
+}
+
+func TestClient_Call_ChunkedResponseReusesConnection(t *testing.T) {
+	var connections int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		// the body is longer than peeked for logging, so the decoder stops short of the last chunk
+		padding := strings.Repeat(" ", peekBodyLimit)
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0",` + padding + `"result": {"status": "ok"},"id": "1"}`))
+		rw.(http.Flusher).Flush() // makes the response chunked
+		time.Sleep(10 * time.Millisecond)
+		_, _ = rw.Write([]byte("\n"))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&connections, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	client := apiClient{HTTPClient: server.Client(), Config: &Config{BaseURL: server.URL}}
+	for i := 0; i < 3; i++ {
+		var result struct{ Status string }
+		assert.NoError(t, client.Call("any.method", struct{}{}, &result))
+		assert.Equal(t, "ok", result.Status)
+	}
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&connections))
+}
+
+func TestClient_Call_RawParams(t *testing.T) {
+	params := json.RawMessage(`{ "merchant_id": 1 }`)
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, err := ioutil.ReadAll(req.Body)
+		assert.NoError(t, err)
+		assert.True(t, json.Valid(body))
+		assert.Contains(t, string(body), `"params":{ "merchant_id": 1 }`)
+
+		_, _ = rw.Write([]byte("{}"))
+	}))
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL: server.URL,
+		},
+	}
+
+	err := client.Call("any.method", params, &struct{}{})
+	assert.NoError(t, err)
+}
+
+func TestClient_Call_InvalidRawParams(t *testing.T) {
+	client := apiClient{
+		HTTPClient: http.DefaultClient,
+		Config:     &Config{},
+	}
+
+	err := client.Call("any.method", json.RawMessage(`{`), &struct{}{})
+	assert.EqualError(t, err, "params is not a valid JSON")
+}
+
+type invalidParams struct{}
+
+func (invalidParams) Validate() error {
+	return errors.New("merchant_id is required")
+}
+
+func TestClient_Call_InvalidParams(t *testing.T) {
+	var reqCounter int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		reqCounter++
+	}))
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL: server.URL,
+		},
+	}
+
+	err := client.Call("any.method", invalidParams{}, &struct{}{})
+
+	assert.EqualError(t, err, "merchant_id is required")
+	assert.Equal(t, 0, reqCounter)
+}
+
+func TestClient_Call_CancelledContext(t *testing.T) {
+	var reqCounter int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		reqCounter++
+	}))
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL: server.URL,
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := client.CallWithContext(ctx, "any.method", struct{}{}, &struct{}{})
+
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 0, reqCounter)
+}
+
+func TestClient_Call_EncodeMethodInPath(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "/v3/merchant.Get%20Details", req.URL.EscapedPath())
+
+		body, err := ioutil.ReadAll(req.Body)
+		assert.NoError(t, err)
+		assert.Contains(t, string(body), `"method":"merchant.Get Details"`)
+
+		_, _ = rw.Write([]byte("{}"))
+	}))
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL:            server.URL + "/v3",
+			EncodeMethodInPath: true,
+		},
+	}
+
+	err := client.Call("merchant.Get Details", struct{}{}, &struct{}{})
+	assert.NoError(t, err)
+}
+
+func TestClient_Call_EmptyMethod(t *testing.T) {
+	var reqCounter int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		reqCounter++
+	}))
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL: server.URL,
+		},
+	}
+
+	assert.Equal(t, ErrEmptyMethod, client.Call("", struct{}{}, &struct{}{}))
+	assert.Equal(t, ErrEmptyMethod, client.Call(" \t", struct{}{}, &struct{}{}))
+	assert.Equal(t, 0, reqCounter)
+}
+
+func TestClient_Call_TrimMethod(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, err := ioutil.ReadAll(req.Body)
+		assert.NoError(t, err)
+		assert.Contains(t, string(body), `"method":"any.method"`)
+
+		_, _ = rw.Write([]byte("{}"))
+	}))
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL: server.URL,
+		},
+	}
+
+	assert.NoError(t, client.Call(" any.method\n", struct{}{}, &struct{}{}))
+}
+
 func TestClient_Call_Success(t *testing.T) {
 	server := testServer(`{"jsonrpc": "2.0","result": {"key": "Value"},"id": "1"}`)
 
@@ -65,42 +444,1017 @@ func TestClient_Call_Success(t *testing.T) {
 	assert.Equal(t, "Value", result.Key)
 }
 
-func TestClient_Call_Error(t *testing.T) {
-	server := testServer(`{"jsonrpc": "2.0","error": {"code": 1, "message": "test error"},"id": "1"}`)
+func TestClient_Call_SnakeCaseCodec(t *testing.T) {
+	server := testServer(`{"jsonrpc": "2.0","result": {"merchant_id": 1},"id": "1"}`)
 
 	client := apiClient{
 		HTTPClient: server.Client(),
 		Config: &Config{
 			BaseURL: server.URL,
+			Codec:   SnakeCaseCodec{},
 		},
 	}
 
-	params := struct{}{}
-	result := struct{}{}
-	err := client.Call("any.method", params, result)
+	result := &struct {
+		MerchantID int
+	}{}
+	err := client.Call("any.method", struct{}{}, result)
 
-	assert.Error(t, err)
-	assert.Equal(t, "test error (1)", fmt.Sprintf("%s", err))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.MerchantID)
 }
 
-func TestClient_Call_SuccessAfterRetry(t *testing.T) {
-	var reqCounter int
+func TestClient_CallRequest_CustomID(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
-		reqCounter++
-		if reqCounter <= 1 {
-			// fail request on the first attempt
-			rw.WriteHeader(500)
+		body, err := ioutil.ReadAll(req.Body)
+		assert.NoError(t, err)
+		assert.Contains(t, string(body), `"id":"42"`)
+
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {"key": "Value"},"id": "42"}`))
+	}))
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL: server.URL,
+		},
+	}
+
+	result := &struct {
+		Key string `json:"key"`
+	}{}
+	err := client.CallRequest(context.Background(), Request{Method: "any.method", Params: struct{}{}, ID: "42"}, result)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Value", result.Key)
+}
+
+func TestClient_CallRequest_IDMismatch(t *testing.T) {
+	server := testServer(`{"jsonrpc": "2.0","result": {},"id": "1"}`)
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL: server.URL,
+		},
+	}
+
+	err := client.CallRequest(context.Background(), Request{Method: "any.method", ID: "42"}, &struct{}{})
+
+	assert.EqualError(t, err, `response id "1" doesn't match request id "42"`)
+}
+
+func TestClient_Call_DoubleEncodedResult(t *testing.T) {
+	server := testServer(`{"jsonrpc": "2.0","result": "{\"merchant_id\":1}","id": "1"}`)
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL:                   server.URL,
+			UnwrapDoubleEncodedResult: true,
+		},
+	}
+
+	result := &struct {
+		MerchantID int `json:"merchant_id"`
+	}{}
+	err := client.Call("any.method", struct{}{}, result)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.MerchantID)
+}
+
+func TestUnwrapDoubleEncoded(t *testing.T) {
+	assert.Equal(t, `{"a":1}`, string(unwrapDoubleEncoded(json.RawMessage(`"{\"a\":1}"`))))
+	assert.Equal(t, `[1]`, string(unwrapDoubleEncoded(json.RawMessage(`"[1]"`))))
+	assert.Equal(t, `"\"[1]\""`, string(unwrapDoubleEncoded(json.RawMessage(`"\"[1]\""`))))
+	assert.Equal(t, `"text"`, string(unwrapDoubleEncoded(json.RawMessage(`"text"`))))
+	assert.Equal(t, `"42"`, string(unwrapDoubleEncoded(json.RawMessage(`"42"`))))
+	assert.Equal(t, `{"a":1}`, string(unwrapDoubleEncoded(json.RawMessage(`{"a":1}`))))
+}
+
+func TestClient_Call_RequireJSONRPCField(t *testing.T) {
+	server := testServer(`{"status": "ok"}`)
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL:             server.URL,
+			RequireJSONRPCField: true,
+		},
+	}
+
+	err := client.Call("any.method", struct{}{}, &struct{}{})
+	assert.EqualError(t, err, "response is missing jsonrpc member")
+
+	client.Config.RequireJSONRPCField = false
+	err = client.Call("any.method", struct{}{}, &struct{}{})
+	assert.NoError(t, err)
+}
+
+func TestClient_Call_Error(t *testing.T) {
+	server := testServer(`{"jsonrpc": "2.0","error": {"code": 1, "message": "test error"},"id": "1"}`)
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL: server.URL,
+		},
+	}
+
+	params := struct{}{}
+	result := struct{}{}
+	err := client.Call("any.method", params, result)
+
+	assert.Error(t, err)
+	assert.Equal(t, "test error (1)", fmt.Sprintf("%s", err))
+}
+
+func TestClient_Call_DecodeResultWithError(t *testing.T) {
+	server := testServer(`{"jsonrpc": "2.0","result": {"processed": 2},"error": {"code": 7, "message": "partially failed"},"id": "1"}`)
+	defer server.Close()
+
+	var result struct{ Processed int }
+	call := func(decode bool) error {
+		result.Processed = 0
+		client := apiClient{HTTPClient: server.Client(), Config: &Config{BaseURL: server.URL, DecodeResultWithError: decode}}
+		return client.Call("any.method", struct{}{}, &result)
+	}
+
+	err := call(true)
+	var rpcErr *RPCError
+	assert.True(t, errors.As(err, &rpcErr))
+	assert.Equal(t, 7, rpcErr.Code)
+	assert.Equal(t, 2, result.Processed)
+
+	assert.EqualError(t, call(false), "partially failed (7)")
+	assert.Equal(t, 0, result.Processed, "the result is discarded by default")
+}
+
+func TestClient_Call_SuccessAfterRetry(t *testing.T) {
+	var reqCounter int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		reqCounter++
+		if reqCounter <= 1 {
+			// fail request on the first attempt
+			rw.WriteHeader(500)
+			return
+		}
+
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {"key": "Value"},"id": "1"}`))
+	}))
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL:  server.URL,
+			RetryMax: 2,
+		},
+	}
+
+	result := &struct {
+		Key string `json:"key"`
+	}{}
+	err := client.Call("any.method", struct{}{}, result)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Value", result.Key)
+}
+
+func TestClient_Call_FailAfterAllRetries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(500)
+	}))
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL:  server.URL,
+			RetryMax: 2,
+		},
+	}
+
+	err := client.Call("any.method", &struct{}{}, &struct{}{})
+	err = errors.Unwrap(err)
+
+	assert.Error(t, err)
+	assert.Equal(t, "500 Internal Server Error", err.Error())
+}
+
+func TestClient_Call_DoNotRetry(t *testing.T) {
+	var reqCounter int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		reqCounter++
+		assert.LessOrEqual(t, 1, reqCounter)
+		rw.WriteHeader(401)
+	}))
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL:  server.URL,
+			RetryMax: 0,
+		},
+	}
+
+	err := client.Call("any.method", &struct{}{}, &struct{}{})
+	err = errors.Unwrap(err)
+
+	assert.Error(t, err)
+	assert.Equal(t, "401 Unauthorized", err.Error())
+}
+
+func TestClient_Call_RetryWhileEmpty(t *testing.T) {
+	var reqCounter int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		reqCounter++
+		if reqCounter <= 1 {
+			_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {},"id": "1"}`))
+			return
+		}
+
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {"key": "Value"},"id": "1"}`))
+	}))
+
+	type keyResult struct {
+		Key string `json:"key"`
+	}
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL:  server.URL,
+			RetryMax: 2,
+			RetryWhileEmpty: func(result interface{}) bool {
+				return result.(*keyResult).Key == ""
+			},
+		},
+	}
+
+	result := &keyResult{}
+	err := client.Call("any.method", struct{}{}, result)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Value", result.Key)
+	assert.Equal(t, 2, reqCounter)
+}
+
+func TestClient_Call_RetryWhileEmptyGivesUp(t *testing.T) {
+	var reqCounter int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		reqCounter++
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {},"id": "1"}`))
+	}))
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL:  server.URL,
+			RetryMax: 2,
+			RetryWhileEmpty: func(result interface{}) bool {
+				return true
+			},
+		},
+	}
+
+	err := client.Call("any.method", struct{}{}, &struct{}{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, reqCounter)
+}
+
+func rejectNotOK(resp *http.Response, body []byte) error {
+	var status struct {
+		OK *bool `json:"ok"`
+	}
+	if err := json.Unmarshal(body, &status); err == nil && status.OK != nil && !*status.OK {
+		return fmt.Errorf("%w: gateway responded with %s", ErrRetryableResponse, body)
+	}
+
+	return nil
+}
+
+func TestClient_Call_SuccessPredicate(t *testing.T) {
+	server := testServer(`{"ok":false}`)
+	defer server.Close()
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL: server.URL,
+			SuccessPredicate: func(resp *http.Response, body []byte) error {
+				if string(body) == `{"ok":false}` {
+					return errors.New("gateway error page")
+				}
+				return nil
+			},
+		},
+	}
+
+	err := client.Call("any.method", struct{}{}, &struct{}{})
+
+	var retryErr *RetryError
+	if assert.True(t, errors.As(err, &retryErr)) {
+		assert.Equal(t, 1, retryErr.Attempts)
+		assert.EqualError(t, retryErr.Err, "gateway error page")
+	}
+}
+
+func TestClient_Call_SuccessPredicateRetry(t *testing.T) {
+	var reqCounter int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		reqCounter++
+		if reqCounter <= 1 {
+			_, _ = rw.Write([]byte(`{"ok":false}`))
+			return
+		}
+
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {"key": "Value"},"id": "1"}`))
+	}))
+	defer server.Close()
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL:          server.URL,
+			RetryMax:         2,
+			SuccessPredicate: rejectNotOK,
+		},
+	}
+
+	result := &struct {
+		Key string `json:"key"`
+	}{}
+	err := client.Call("any.method", struct{}{}, result)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Value", result.Key)
+	assert.Equal(t, 2, reqCounter)
+}
+
+func TestClient_Call_RetryOnBodyMatch(t *testing.T) {
+	var reqCounter int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		reqCounter++
+		if reqCounter <= 1 {
+			_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","error": {"code": 503, "message": "backend saturated"},"id": "1"}`))
+			return
+		}
+
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {"key": "Value"},"id": "1"}`))
+	}))
+	defer server.Close()
+
+	client := apiClient{
+		HTTPClient:     server.Client(),
+		RequestBackoff: NoBackoff,
+		Config: &Config{
+			BaseURL:  server.URL,
+			RetryMax: 2,
+			RetryOnBodyMatch: func(body []byte) bool {
+				return strings.Contains(string(body), `"code": 503`)
+			},
+		},
+	}
+
+	result := &struct {
+		Key string `json:"key"`
+	}{}
+	err := client.Call("any.method", struct{}{}, result)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Value", result.Key, "the body of the final success is decoded")
+	assert.Equal(t, 2, reqCounter)
+}
+
+func TestClient_Call_StaleConnection(t *testing.T) {
+	var sends int
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		sends++
+		if sends == 1 {
+			// the pooled connection is found closed by the server before the request is written
+			httptrace.ContextClientTrace(req.Context()).GotConn(httptrace.GotConnInfo{Reused: true})
+			return nil, io.EOF
+		}
+
+		body := `{"jsonrpc": "2.0","result": {"key": "Value"},"id": "1"}`
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(body)), Header: http.Header{}}, nil
+	})
+
+	client := apiClient{
+		HTTPClient: &http.Client{Transport: transport},
+		Config: &Config{
+			BaseURL:             "http://localhost",
+			NonRetryableMethods: []string{"payment.create"},
+		},
+	}
+
+	result := &struct {
+		Key string `json:"key"`
+	}{}
+	err := client.Call("payment.create", struct{}{}, result)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Value", result.Key)
+	assert.Equal(t, 2, sends, "the payment is resent once over a new connection")
+}
+
+func TestClient_Call_ConnectionLostAfterWrite(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {},"id": "1"}`))
+			return
+		}
+
+		// the request has been read, but the connection is closed before the response
+		conn, _, err := rw.(http.Hijacker).Hijack()
+		if err == nil {
+			_ = conn.Close()
+		}
+	}))
+	defer server.Close()
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL:             server.URL,
+			RetryMax:            2,
+			NonRetryableMethods: []string{"payment.create"},
+		},
+		RequestBackoff: NoBackoff,
+	}
+
+	assert.NoError(t, client.Call("payment.create", struct{}{}, &struct{}{}))
+
+	err := client.Call("payment.create", struct{}{}, &struct{}{})
+
+	assert.Error(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests), "the payment written over the reused connection isn't resent")
+}
+
+func TestClient_Call_EOFOverNewConnection(t *testing.T) {
+	var requests int
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requests++
+		return nil, io.EOF
+	})
+
+	client := apiClient{
+		HTTPClient: &http.Client{Transport: transport},
+		Config:     &Config{BaseURL: "http://localhost", RetryMax: 0},
+	}
+
+	err := client.Call("any.method", struct{}{}, &struct{}{})
+
+	assert.True(t, errors.Is(err, io.EOF), "unexpected error: %v", err)
+	assert.Equal(t, 1, requests, "the failure over a new connection isn't resent")
+}
+
+func TestClient_Call_RetryUntilDeadline(t *testing.T) {
+	var reqCounter int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&reqCounter, 1)
+		rw.WriteHeader(500)
+	}))
+	defer server.Close()
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		RequestBackoff: func(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
+			return 100 * time.Millisecond
+		},
+		Config: &Config{
+			BaseURL:            server.URL,
+			RetryMax:           0,
+			RetryUntilDeadline: true,
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 350*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := client.CallWithContext(ctx, "any.method", struct{}{}, &struct{}{})
+
+	// attempts at 0, 100, 200 and 300ms, the next one at 400ms would miss the deadline
+	assert.Equal(t, int32(4), atomic.LoadInt32(&reqCounter))
+	assert.Less(t, int64(time.Since(start)), int64(350*time.Millisecond))
+	var statusErr *StatusError
+	assert.True(t, errors.As(err, &statusErr), "unexpected error: %v", err)
+}
+
+func TestClient_Call_FailOnRetryAfterDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Retry-After", "10")
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL:                  server.URL,
+			RetryMax:                 3,
+			FailOnRetryAfterDeadline: true,
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	start := time.Now()
+	err := client.CallWithContext(ctx, "any.method", struct{}{}, &struct{}{})
+
+	assert.True(t, errors.Is(err, ErrRetryAfterExceedsDeadline), "unexpected error: %v", err)
+	assert.EqualError(t, err, "retry after exceeds the deadline: asked to wait 10s")
+	assert.Less(t, int64(time.Since(start)), int64(500*time.Millisecond), "the call fails without waiting")
+}
+
+func TestClient_Call_FailOnClampedRetryAfterDeadline(t *testing.T) {
+	var reqCounter int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&reqCounter, 1)
+		rw.Header().Set("Retry-After", "10")
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := apiClient{
+		HTTPClient:     server.Client(),
+		RequestBackoff: NoBackoff,
+		Config: &Config{
+			BaseURL:                  server.URL,
+			RetryMax:                 1,
+			MaxRetryAfter:            10 * time.Millisecond,
+			FailOnRetryAfterDeadline: true,
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err := client.CallWithContext(ctx, "any.method", struct{}{}, &struct{}{})
+
+	assert.False(t, errors.Is(err, ErrRetryAfterExceedsDeadline), "the clamped wait fits the deadline: %v", err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&reqCounter))
+}
+
+// throttledRetryer retries 429 responses once waiting as the inner retryer suggests
+type throttledRetryer struct {
+	RequestRetryer
+}
+
+func (r throttledRetryer) ShouldRetry(ctx context.Context, resp *http.Response, attemptNum int, err error) (bool, error) {
+	return attemptNum == 1 && resp != nil && resp.StatusCode == http.StatusTooManyRequests, nil
+}
+
+func TestClient_Call_MaxRetryAfter(t *testing.T) {
+	retryers := map[string]RequestRetryer{
+		"exponential": NewDefaultRetryer(1, time.Millisecond, time.Second, ExponentialJitterBackoff),
+		"linear":      NewDefaultRetryer(1, time.Millisecond, time.Second, LinearJitterBackoff),
+		"constant":    NewConstantRequestRetryer(1, time.Millisecond),
+	}
+
+	for name, retryer := range retryers {
+		var requests int
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			requests++
+			if requests == 1 {
+				rw.Header().Set("Retry-After", "999999")
+				rw.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {},"id": "1"}`))
+		}))
+
+		var waits []time.Duration
+		var warnings []string
+		client := apiClient{
+			HTTPClient: server.Client(),
+			Config: &Config{
+				BaseURL:       server.URL,
+				Retryer:       throttledRetryer{retryer},
+				MaxRetryAfter: time.Minute,
+				Logger: LoggerFunc(func(level LogLevel, format string, args ...interface{}) {
+					if level == WarningLevel {
+						warnings = append(warnings, fmt.Sprintf(format, args...))
+					}
+				}),
+			},
+			after: func(d time.Duration) <-chan time.Time {
+				waits = append(waits, d)
+				return time.After(0)
+			},
+		}
+
+		assert.NoError(t, client.Call("any.method", struct{}{}, &struct{}{}), name)
+		assert.Equal(t, []time.Duration{time.Minute}, waits, name)
+		assert.Equal(t, []string{"any.method is asked to wait 277h46m39s by Retry-After, waiting 1m0s instead"}, warnings, name)
+
+		server.Close()
+	}
+}
+
+func TestClient_Call_AttemptHeader(t *testing.T) {
+	var attempts []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		attempts = append(attempts, req.Header.Get(AttemptHeaderName))
+		if len(attempts) <= 2 {
+			rw.WriteHeader(500)
+			return
+		}
+
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {},"id": "1"}`))
+	}))
+	defer server.Close()
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL:       server.URL,
+			RetryMax:      2,
+			AttemptHeader: AttemptHeaderName,
+		},
+	}
+
+	err := client.Call("any.method", struct{}{}, &struct{}{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "2", "3"}, attempts)
+}
+
+func TestClient_Call_NonRetryableMethods(t *testing.T) {
+	var reqCounter int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		reqCounter++
+		rw.WriteHeader(500)
+	}))
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL:             server.URL,
+			RetryMax:            3,
+			NonRetryableMethods: []string{"payment.create"},
+		},
+	}
+
+	err := client.Call("payment.create", &struct{}{}, &struct{}{})
+
+	assert.Equal(t, 1, reqCounter)
+	var retryErr *RetryError
+	if assert.True(t, errors.As(err, &retryErr)) {
+		assert.Equal(t, 1, retryErr.Attempts)
+		assert.Equal(t, "500 Internal Server Error", retryErr.Err.Error())
+	}
+
+	reqCounter = 0
+	_ = client.Call("payment.get", &struct{}{}, &struct{}{})
+	assert.Equal(t, 4, reqCounter)
+}
+
+func TestClient_Call_MaxConcurrentRequests(t *testing.T) {
+	var inFlight, maxInFlight int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		current := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			seen := atomic.LoadInt32(&maxInFlight)
+			if current <= seen || atomic.CompareAndSwapInt32(&maxInFlight, seen, current) {
+				break
+			}
+		}
+
+		time.Sleep(20 * time.Millisecond)
+		_, _ = rw.Write([]byte("{}"))
+	}))
+
+	cfg := NewConfig("key", "secret")
+	cfg.BaseURL = server.URL
+	cfg.MaxConcurrentRequests = 2
+	client := New(cfg).(*apiClient)
+	client.HTTPClient = server.Client()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, client.Call("any.method", struct{}{}, &struct{}{}))
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&maxInFlight))
+}
+
+func TestClient_Call_MaxConcurrentRequestsCancelled(t *testing.T) {
+	cfg := NewConfig("key", "secret")
+	cfg.MaxConcurrentRequests = 1
+	client := New(cfg).(*apiClient)
+	client.semaphore <- struct{}{} // occupy the only slot
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := client.CallWithContext(ctx, "any.method", struct{}{}, &struct{}{})
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestClient_Call_DeadlineHeader(t *testing.T) {
+	deadline := time.Now().Add(time.Minute)
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		header, err := time.Parse(time.RFC3339Nano, req.Header.Get("X-Request-Deadline"))
+		assert.NoError(t, err)
+		assert.WithinDuration(t, deadline, header, time.Millisecond)
+
+		_, _ = rw.Write([]byte("{}"))
+	}))
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL: server.URL,
+		},
+	}
+
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	err := client.CallWithContext(ctx, "any.method", struct{}{}, &struct{}{})
+	assert.NoError(t, err)
+}
+
+func TestClient_Call_DeadlineHeaderRemainingMs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		remaining, err := strconv.ParseInt(req.Header.Get("X-Request-Deadline"), 10, 64)
+		assert.NoError(t, err)
+		assert.InDelta(t, 60000, remaining, 1000)
+
+		_, _ = rw.Write([]byte("{}"))
+	}))
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL:        server.URL,
+			DeadlineFormat: DeadlineRemainingMs,
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	err := client.CallWithContext(ctx, "any.method", struct{}{}, &struct{}{})
+	assert.NoError(t, err)
+}
+
+func TestClient_Call_NoDeadlineHeader(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.NotContains(t, req.Header, "X-Request-Deadline")
+
+		_, _ = rw.Write([]byte("{}"))
+	}))
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL: server.URL,
+		},
+	}
+
+	err := client.Call("any.method", struct{}{}, &struct{}{})
+	assert.NoError(t, err)
+}
+
+func TestClient_Call_OnComplete(t *testing.T) {
+	response := `{"jsonrpc": "2.0","result": {"key": "Value"},"id": "1"}`
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		_, _ = rw.Write([]byte(response))
+	}))
+
+	var info CallInfo
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL: server.URL,
+			OnComplete: func(i CallInfo) {
+				info = i
+			},
+		},
+	}
+
+	err := client.Call("any.method", struct{}{}, &struct{}{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "any.method", info.Method)
+	assert.Equal(t, 1, info.Attempts)
+	assert.Equal(t, http.StatusOK, info.StatusCode)
+	assert.Equal(t, int64(len(response)), info.ResponseBytes)
+	assert.GreaterOrEqual(t, info.TimeToFirstByte.Nanoseconds(), (50 * time.Millisecond).Nanoseconds())
+	assert.LessOrEqual(t, info.TimeToFirstByte.Nanoseconds(), info.Duration.Nanoseconds())
+	assert.NoError(t, info.Err)
+}
+
+func TestNew_LocalAddr(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		host, _, err := net.SplitHostPort(req.RemoteAddr)
+		assert.NoError(t, err)
+		assert.Equal(t, "127.0.0.1", host)
+
+		_, _ = rw.Write([]byte("{}"))
+	}))
+
+	cfg := NewConfig("key", "secret")
+	cfg.BaseURL = server.URL
+	cfg.LocalAddr = "127.0.0.1"
+	client := New(cfg).(*apiClient)
+
+	assert.IsType(t, &http.Transport{}, client.HTTPClient.Transport)
+
+	err := client.Call("any.method", struct{}{}, &struct{}{})
+	assert.NoError(t, err)
+}
+
+func TestPeekBody(t *testing.T) {
+	body := ioutil.NopCloser(strings.NewReader(`{"key": "Value"}`))
+
+	peeked, replay, err := peekBody(body, 7)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"key":`, string(peeked))
+
+	result := &struct {
+		Key string `json:"key"`
+	}{}
+	assert.NoError(t, json.NewDecoder(replay).Decode(result))
+	assert.Equal(t, "Value", result.Key)
+	assert.NoError(t, replay.Close())
+}
+
+func TestClient_Call_RetryMaxZero(t *testing.T) {
+	var reqCounter int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		reqCounter++
+		rw.WriteHeader(500)
+	}))
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL:  server.URL,
+			RetryMax: 0,
+		},
+	}
+
+	err := client.Call("any.method", &struct{}{}, &struct{}{})
+
+	var statusErr *StatusError
+	assert.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusInternalServerError, statusErr.StatusCode)
+	assert.Equal(t, 1, reqCounter)
+}
+
+func TestClient_Call_DefaultRetryMax(t *testing.T) {
+	var reqCounter int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&reqCounter, 1)
+		rw.WriteHeader(500)
+	}))
+	defer server.Close()
+
+	config := NewConfig("public", "secret")
+	config.BaseURL = server.URL
+
+	err := New(config).Call("any.method", struct{}{}, &struct{}{})
+
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&reqCounter), "the default config makes a single attempt")
+}
+
+func TestClient_Call_RetryMax(t *testing.T) {
+	var reqCounter int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		reqCounter++
+		rw.WriteHeader(500)
+	}))
+
+	client := apiClient{
+		HTTPClient:     server.Client(),
+		RequestBackoff: NoBackoff,
+		Config: &Config{
+			BaseURL:  server.URL,
+			RetryMax: 2,
+		},
+	}
+
+	err := client.Call("any.method", &struct{}{}, &struct{}{})
+
+	assert.Error(t, err)
+	assert.Equal(t, 3, reqCounter)
+}
+
+func TestClient_Call_RetryHistory(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(500)
+	}))
+
+	// fail every second attempt with a connection error
+	var attempts int
+	transport := server.Client().Transport
+	httpClient := &http.Client{
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			attempts++
+			if attempts%2 == 0 {
+				return nil, errors.New("connection reset by peer")
+			}
+			return transport.RoundTrip(req)
+		}),
+	}
+
+	client := apiClient{
+		HTTPClient:     httpClient,
+		RequestBackoff: NoBackoff,
+		Config: &Config{
+			BaseURL:  server.URL,
+			RetryMax: 3,
+		},
+	}
+
+	err := client.Call("any.method", &struct{}{}, &struct{}{})
+
+	var retryErr *RetryError
+	assert.True(t, errors.As(err, &retryErr))
+	assert.Equal(t, 4, retryErr.Attempts)
+	assert.Len(t, retryErr.History, 4)
+	for i, record := range retryErr.History {
+		assert.Equal(t, i+1, record.Attempt)
+		assert.Error(t, record.Err)
+		if i%2 == 0 {
+			assert.Equal(t, http.StatusInternalServerError, record.StatusCode)
+		} else {
+			assert.Equal(t, 0, record.StatusCode)
+		}
+	}
+}
+
+func TestRecordAttempt_Bounded(t *testing.T) {
+	var history []AttemptRecord
+	for attempt := 1; attempt <= 15; attempt++ {
+		history = recordAttempt(history, attempt, time.Now(), nil, errors.New("failed"), nil)
+	}
+
+	assert.Len(t, history, maxAttemptHistory)
+	assert.Equal(t, 6, history[0].Attempt)
+	assert.Equal(t, 15, history[len(history)-1].Attempt)
+}
+
+func TestNew_DialContext(t *testing.T) {
+	server := testServer("{}")
+
+	var dialed []string
+	dialer := &net.Dialer{}
+	cfg := NewConfig("key", "secret")
+	cfg.BaseURL = server.URL
+	cfg.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	err := New(cfg).Call("any.method", struct{}{}, &struct{}{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{server.Listener.Addr().String()}, dialed)
+}
+
+func TestClient_Call_RetryableRPCError(t *testing.T) {
+	var reqCounter int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		reqCounter++
+		body, err := ioutil.ReadAll(req.Body)
+		assert.NoError(t, err)
+		assert.Contains(t, string(body), `"method":"any.method"`)
+
+		if reqCounter <= 1 {
+			_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","error": {"code": 1, "message": "busy", "data": {"retry": true}},"id": "1"}`))
 			return
 		}
-
 		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {"key": "Value"},"id": "1"}`))
 	}))
 
 	client := apiClient{
-		HTTPClient: server.Client(),
+		HTTPClient:     server.Client(),
+		RequestBackoff: NoBackoff,
 		Config: &Config{
 			BaseURL:  server.URL,
-			RetryMax: 2,
+			RetryMax: 1,
+			RetryableRPCError: func(err *RPCError) bool {
+				data := struct {
+					Retry bool `json:"retry"`
+				}{}
+				return json.Unmarshal(err.Data, &data) == nil && data.Retry
+			},
 		},
 	}
 
@@ -111,49 +1465,64 @@ func TestClient_Call_SuccessAfterRetry(t *testing.T) {
 
 	assert.NoError(t, err)
 	assert.Equal(t, "Value", result.Key)
+	assert.Equal(t, 2, reqCounter)
 }
 
-func TestClient_Call_FailAfterAllRetries(t *testing.T) {
+func TestClient_Call_RetryableRPCErrorRetryer(t *testing.T) {
+	var reqCounter int32
 	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
-		rw.WriteHeader(500)
+		if atomic.AddInt32(&reqCounter, 1) == 1 {
+			rw.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","error": {"code": 1, "message": "busy"},"id": "1"}`))
 	}))
+	defer server.Close()
 
+	var info CallInfo
 	client := apiClient{
 		HTTPClient: server.Client(),
 		Config: &Config{
-			BaseURL:  server.URL,
-			RetryMax: 2,
+			BaseURL:           server.URL,
+			Retryer:           NewScheduleRetryer([]time.Duration{0, 0, 0}),
+			RetryableRPCError: func(err *RPCError) bool { return true },
+			OnComplete:        func(completed CallInfo) { info = completed },
 		},
 	}
 
-	err := client.Call("any.method", &struct{}{}, &struct{}{})
-	err = errors.Unwrap(err)
+	err := client.Call("any.method", struct{}{}, &struct{}{})
 
-	assert.Error(t, err)
-	assert.Equal(t, "500 Internal Server Error", err.Error())
+	var rpcErr *RPCError
+	assert.True(t, errors.As(err, &rpcErr), "unexpected error: %v", err)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&reqCounter), "the retryer limits the attempts of the repeated requests too")
+	assert.Equal(t, 4, info.Attempts, "the attempts of all requests of the call are counted")
 }
 
-func TestClient_Call_DoNotRetry(t *testing.T) {
+func TestClient_Call_NotRetryableRPCError(t *testing.T) {
 	var reqCounter int
 	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
 		reqCounter++
-		assert.LessOrEqual(t, 1, reqCounter)
-		rw.WriteHeader(401)
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","error": {"code": 1, "message": "invalid", "data": {"retry": false}},"id": "1"}`))
 	}))
 
 	client := apiClient{
-		HTTPClient: server.Client(),
+		HTTPClient:     server.Client(),
+		RequestBackoff: NoBackoff,
 		Config: &Config{
 			BaseURL:  server.URL,
-			RetryMax: 0,
+			RetryMax: 3,
+			RetryableRPCError: func(err *RPCError) bool {
+				return string(err.Data) == `{"retry": true}`
+			},
 		},
 	}
 
-	err := client.Call("any.method", &struct{}{}, &struct{}{})
-	err = errors.Unwrap(err)
+	err := client.Call("any.method", struct{}{}, &struct{}{})
 
-	assert.Error(t, err)
-	assert.Equal(t, "401 Unauthorized", err.Error())
+	var rpcErr *RPCError
+	assert.True(t, errors.As(err, &rpcErr))
+	assert.Equal(t, 1, rpcErr.Code)
+	assert.Equal(t, 1, reqCounter)
 }
 
 func TestClient_retryPolicy_Status500(t *testing.T) {
@@ -226,6 +1595,36 @@ func TestClient_retryPolicy_UnknownAuthority(t *testing.T) {
 	assert.False(t, shouldRetry)
 }
 
+func TestClient_retryPolicy_DNSNotFound(t *testing.T) {
+	respErr := &url.Error{
+		Op:  "POST",
+		URL: "https://example.net",
+		Err: &net.OpError{
+			Op:  "dial",
+			Net: "tcp",
+			Err: &net.DNSError{Err: "no such host", Name: "example.net", IsNotFound: true},
+		},
+	}
+	shouldRetry, err := retryPolicy(nil, respErr)
+	assert.Equal(t, respErr, err)
+	assert.False(t, shouldRetry)
+}
+
+func TestClient_retryPolicy_DNSTemporary(t *testing.T) {
+	respErr := &url.Error{
+		Op:  "POST",
+		URL: "https://example.net",
+		Err: &net.OpError{
+			Op:  "dial",
+			Net: "tcp",
+			Err: &net.DNSError{Err: "server misbehaving", Name: "example.net", IsTemporary: true},
+		},
+	}
+	shouldRetry, err := retryPolicy(nil, respErr)
+	assert.Equal(t, respErr, err)
+	assert.True(t, shouldRetry)
+}
+
 func TestLinearJitterBackoff(t *testing.T) {
 	min := time.Second
 	max := 2 * time.Second
@@ -261,3 +1660,506 @@ func TestExponentialJitterBackoff(t *testing.T) {
 	assert.Greater(t, backoff2.Nanoseconds(), min.Nanoseconds())
 	assert.Less(t, backoff2.Nanoseconds(), max.Nanoseconds())
 }
+
+func TestNew_BackoffStrategy(t *testing.T) {
+	min := time.Second
+	max := 2 * time.Second
+
+	backoff := func(name string) time.Duration {
+		cfg := NewConfig("key", "secret")
+		cfg.BackoffStrategy = name
+		return New(cfg).(*apiClient).RequestBackoff(min, max, 1, &http.Response{})
+	}
+
+	assert.Equal(t, min, backoff(BackoffConstant))
+	assert.Equal(t, time.Duration(0), backoff(BackoffNone))
+
+	linear := backoff(BackoffLinear)
+	assert.GreaterOrEqual(t, linear.Nanoseconds(), min.Nanoseconds())
+	assert.Less(t, linear.Nanoseconds(), max.Nanoseconds())
+
+	for _, name := range []string{"", BackoffExponential} {
+		exponential := backoff(name)
+		assert.Greater(t, exponential.Nanoseconds(), min.Nanoseconds())
+		assert.Less(t, exponential.Nanoseconds(), 2*max.Nanoseconds())
+	}
+}
+
+func TestNew_JitterSeedPerClient(t *testing.T) {
+	sequence := func(c Client) []time.Duration {
+		var backoffs []time.Duration
+		for attempt := 1; attempt <= 5; attempt++ {
+			backoffs = append(backoffs, c.(*apiClient).RequestBackoff(time.Second, time.Minute, attempt, nil))
+		}
+		return backoffs
+	}
+
+	cfg := NewConfig("key", "secret")
+	assert.NotEqual(t, sequence(New(cfg)), sequence(New(cfg)))
+}
+
+func TestNewExponentialJitterBackoff_SameSeed(t *testing.T) {
+	backoff1 := NewExponentialJitterBackoff(rand.NewSource(42))
+	backoff2 := NewExponentialJitterBackoff(rand.NewSource(42))
+
+	for attempt := 1; attempt <= 5; attempt++ {
+		assert.Equal(t, backoff1(time.Second, time.Minute, attempt, nil), backoff2(time.Second, time.Minute, attempt, nil))
+	}
+}
+
+func TestNew_HTTPTimeout(t *testing.T) {
+	cfg := NewConfig("key", "secret")
+	assert.Equal(t, DefaultHTTPTimeout, New(cfg).(*apiClient).HTTPClient.Timeout)
+
+	cfg.HTTPTimeout = 5 * time.Second
+	assert.Equal(t, 5*time.Second, New(cfg).(*apiClient).HTTPClient.Timeout)
+}
+
+func TestNew_ResponseHeaderTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		<-release
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {},"id": "1"}`))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	cfg := NewConfig("key", "secret")
+	cfg.BaseURL = server.URL
+	cfg.RetryMax = 0
+	cfg.ResponseHeaderTimeout = 20 * time.Millisecond
+	client := New(cfg).(*apiClient)
+
+	assert.Equal(t, 20*time.Millisecond, client.HTTPClient.Transport.(*http.Transport).ResponseHeaderTimeout)
+
+	start := time.Now()
+	err := client.Call("any.method", struct{}{}, &struct{}{})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "timeout awaiting response headers")
+	assert.Less(t, int64(time.Since(start)), int64(time.Second), "the call fails long before HTTPTimeout")
+}
+
+func TestFastFirstRetry(t *testing.T) {
+	min := time.Second
+	max := 60 * time.Second
+	backoff := FastFirstRetry(NewExponentialJitterBackoff(rand.NewSource(1)))
+
+	assert.Equal(t, min, backoff(min, max, 1, &http.Response{}))
+	assert.GreaterOrEqual(t, backoff(min, max, 3, &http.Response{}).Nanoseconds(), (2 * min).Nanoseconds())
+}
+
+func TestWithMaxJitter(t *testing.T) {
+	min := time.Second
+	max := time.Minute
+	maxJitter := 100 * time.Millisecond
+
+	for name, backoff := range map[string]Backoff{
+		"exponential": NewExponentialJitterBackoff(rand.NewSource(1)),
+		"linear":      NewLinearJitterBackoff(rand.NewSource(1)),
+	} {
+		capped := WithMaxJitter(backoff, maxJitter)
+		var previous time.Duration
+		for attempt := 1; attempt <= 4; attempt++ {
+			center := backoff(min, max, attempt, centerProbe)
+			delay := capped(min, max, attempt, nil)
+
+			assert.GreaterOrEqual(t, int64(delay), int64(center-maxJitter), name)
+			assert.LessOrEqual(t, int64(delay), int64(center+maxJitter), name)
+			assert.Greater(t, int64(delay), int64(previous), "%s: the delay grows with the attempts", name)
+			previous = delay
+		}
+	}
+}
+
+func TestWithMaxJitter_RetryAfter(t *testing.T) {
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"5"}}}
+	capped := WithMaxJitter(NewExponentialJitterBackoff(rand.NewSource(1)), 100*time.Millisecond)
+
+	assert.Equal(t, 5*time.Second, capped(time.Second, time.Minute, 1, resp))
+}
+
+func TestNew_UnknownBackoffStrategy(t *testing.T) {
+	var warnings []string
+	cfg := NewConfig("public", "secret")
+	cfg.BackoffStrategy = "fibonacci"
+	cfg.Logger = LoggerFunc(func(level LogLevel, format string, args ...interface{}) {
+		if level == WarningLevel {
+			warnings = append(warnings, fmt.Sprintf(format, args...))
+		}
+	})
+
+	New(cfg)
+
+	assert.Equal(t, []string{`unknown backoff strategy "fibonacci", the exponential one is used`}, warnings)
+}
+
+func TestNew_FastFirstRetry(t *testing.T) {
+	cfg := NewConfig("key", "secret")
+	cfg.FirstRetry = FirstRetryMinWait
+	client := New(cfg).(*apiClient)
+
+	assert.Equal(t, time.Second, client.RequestBackoff(time.Second, time.Minute, 1, &http.Response{}))
+	assert.Greater(t, client.RequestBackoff(time.Second, time.Minute, 3, &http.Response{}).Nanoseconds(), time.Second.Nanoseconds())
+}
+
+func TestFirstRetryImmediate(t *testing.T) {
+	min := time.Second
+	max := 60 * time.Second
+	backoff := FirstRetryImmediate(NewExponentialJitterBackoff(rand.NewSource(1)))
+
+	assert.Equal(t, time.Duration(0), backoff(min, max, 1, &http.Response{}))
+	assert.Greater(t, backoff(min, max, 2, &http.Response{}).Nanoseconds(), int64(0))
+	assert.Equal(t, 3*time.Second, backoff(min, max, 1, &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Header:     http.Header{"Retry-After": {"3"}},
+	}))
+}
+
+func TestNew_FirstRetryImmediate(t *testing.T) {
+	cfg := NewConfig("key", "secret")
+	cfg.FirstRetry = FirstRetryNoWait
+	client := New(cfg).(*apiClient)
+
+	assert.Equal(t, time.Duration(0), client.RequestBackoff(time.Second, time.Minute, 1, &http.Response{}))
+	assert.Greater(t, client.RequestBackoff(time.Second, time.Minute, 2, &http.Response{}).Nanoseconds(), int64(0))
+}
+
+func TestClient_Call_RequestBodyAcrossRetries(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, err := ioutil.ReadAll(req.Body)
+		assert.NoError(t, err)
+		bodies = append(bodies, string(body))
+		if len(bodies) <= 1 {
+			rw.WriteHeader(500)
+			return
+		}
+
+		_, _ = rw.Write([]byte("{}"))
+	}))
+
+	client := apiClient{
+		HTTPClient:     server.Client(),
+		RequestBackoff: NoBackoff,
+		Config: &Config{
+			BaseURL:  server.URL,
+			RetryMax: 1,
+		},
+	}
+
+	err := client.Call("any.method", map[string]int{"merchant_id": 1}, &struct{}{})
+
+	assert.NoError(t, err)
+	expected := `{"jsonrpc":"2.0","method":"any.method","id":"1","params":{"merchant_id":1}}`
+	assert.Equal(t, []string{expected, expected}, bodies)
+}
+
+func TestClient_Call_RequestBodyConcurrent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rpcReq := struct {
+			Params json.RawMessage `json:"params"`
+		}{}
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(&rpcReq))
+
+		_, _ = fmt.Fprintf(rw, `{"jsonrpc": "2.0","result": %s,"id": "1"}`, rpcReq.Params)
+	}))
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL: server.URL,
+		},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			result := map[string]int{}
+			assert.NoError(t, client.Call("any.method", map[string]int{"merchant_id": id}, &result))
+			assert.Equal(t, id, result["merchant_id"])
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestClient_Call_RequestBodyOutlivesCall(t *testing.T) {
+	var bodies []func() (io.ReadCloser, error)
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		bodies = append(bodies, req.GetBody)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"jsonrpc": "2.0","result": {},"id": "1"}`)),
+		}, nil
+	})
+
+	client := apiClient{
+		HTTPClient: &http.Client{Transport: transport},
+		Config:     &Config{BaseURL: "http://localhost"},
+	}
+
+	assert.NoError(t, client.Call("first.method", struct{}{}, &struct{}{}))
+	assert.NoError(t, client.Call("second.method", struct{}{}, &struct{}{}))
+
+	body, err := bodies[0]()
+	assert.NoError(t, err)
+	data, _ := ioutil.ReadAll(body)
+	assert.Contains(t, string(data), "first.method", "the body isn't reused by the next call")
+}
+
+func BenchmarkRPCRequest_marshal(b *testing.B) {
+	rpcReq := newRPCRequest("merchant.GetDetails", json.RawMessage(`{"merchant_id":1}`), "1")
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := rpcReq.marshal(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestClient_Call_MethodTimeouts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("X-Request-Deadline") != "" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {},"id": "1"}`))
+	}))
+	defer server.Close()
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL:        server.URL,
+			MethodTimeouts: map[string]time.Duration{"quick.lookup": 100 * time.Millisecond},
+		},
+	}
+
+	err := client.Call("quick.lookup", struct{}{}, &struct{}{})
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "unexpected error: %v", err)
+
+	err = client.Call("report.generate", struct{}{}, &struct{}{})
+	assert.NoError(t, err)
+}
+
+type rotatingCredentials struct {
+	secret string
+}
+
+func (c *rotatingCredentials) Credentials(ctx context.Context) (string, string, error) {
+	return "public", c.secret, nil
+}
+
+func TestClient_Call_OnUnauthorized(t *testing.T) {
+	var signatures []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		signatures = append(signatures, req.Header.Get("Authorization"))
+
+		if valid, _ := VerifySignature("public", "rotated", body, req.Header.Get("Authorization")); !valid {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {"key": "Value"},"id": "1"}`))
+	}))
+	defer server.Close()
+
+	credentials := &rotatingCredentials{secret: "stale"}
+	var refreshes int
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL:     server.URL,
+			Credentials: credentials,
+			OnUnauthorized: func(ctx context.Context) error {
+				refreshes++
+				credentials.secret = "rotated"
+				return nil
+			},
+		},
+	}
+
+	result := &struct {
+		Key string `json:"key"`
+	}{}
+	err := client.Call("any.method", struct{}{}, result)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Value", result.Key)
+	assert.Equal(t, 1, refreshes)
+	if assert.Len(t, signatures, 2) {
+		assert.NotEqual(t, signatures[0], signatures[1])
+	}
+}
+
+func TestClient_Call_OnUnauthorizedOnce(t *testing.T) {
+	var reqCounter int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		reqCounter++
+		rw.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	var refreshes int
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL: server.URL,
+			OnUnauthorized: func(ctx context.Context) error {
+				refreshes++
+				return nil
+			},
+		},
+	}
+
+	err := client.Call("any.method", struct{}{}, &struct{}{})
+
+	assert.True(t, isUnauthorized(err))
+	assert.Equal(t, 1, refreshes)
+	assert.Equal(t, 2, reqCounter)
+}
+
+func TestClient_Call_LogsSignatureFingerprint(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		authorization = req.Header.Get("Authorization")
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {},"id": "1"}`))
+	}))
+	defer server.Close()
+
+	var lines []string
+	config := NewConfig("public", "top-secret")
+	config.BaseURL = server.URL
+	config.Logger = LoggerFunc(func(level LogLevel, format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	})
+
+	err := New(config).Call("any.method", struct{}{}, &struct{}{})
+	assert.NoError(t, err)
+
+	signature := strings.TrimPrefix(authorization, "Basic ")
+	sum := sha256.Sum256([]byte(signature))
+	fingerprint := hex.EncodeToString(sum[:])[:8]
+
+	logged := strings.Join(lines, "\n")
+	assert.Contains(t, logged, "signature fingerprint: "+fingerprint)
+	assert.NotContains(t, logged, signature)
+	assert.NotContains(t, logged, "top-secret")
+}
+
+func TestNew_WithTransport(t *testing.T) {
+	var recorded []*http.Request
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		recorded = append(recorded, req)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"jsonrpc": "2.0","result": {},"id": "1"}`)),
+			Request:    req,
+		}, nil
+	})
+
+	client := New(NewConfig("public", "secret"), WithTransport(transport)).(*apiClient)
+
+	err := client.Call("any.method", struct{}{}, &struct{}{})
+
+	assert.NoError(t, err)
+	if assert.Len(t, recorded, 1) {
+		assert.Equal(t, BaseURLV3, recorded[0].URL.String())
+	}
+	assert.Equal(t, DefaultHTTPTimeout, client.HTTPClient.Timeout)
+}
+
+func TestNew_WithHTTPClientTakesPrecedence(t *testing.T) {
+	httpClient := &http.Client{}
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, errors.New("unexpected request")
+	})
+
+	for _, opts := range [][]Option{
+		{WithHTTPClient(httpClient), WithTransport(transport)},
+		{WithTransport(transport), WithHTTPClient(httpClient)},
+	} {
+		client := New(NewConfig("public", "secret"), opts...).(*apiClient)
+
+		assert.Same(t, httpClient, client.HTTPClient)
+		assert.Nil(t, client.HTTPClient.Transport)
+	}
+}
+
+func TestClient_Call_FaultInjector(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {"key": "Value"},"id": "1"}`))
+	}))
+	defer server.Close()
+
+	injected := errors.New("injected fault")
+	var attempts []int
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL:  server.URL,
+			RetryMax: 2,
+			FaultInjector: func(attempt int) error {
+				attempts = append(attempts, attempt)
+				if attempt == 1 {
+					return injected
+				}
+				return nil
+			},
+		},
+	}
+
+	result := &struct {
+		Key string `json:"key"`
+	}{}
+	assert.NoError(t, client.Call("any.method", struct{}{}, result))
+	assert.Equal(t, "Value", result.Key)
+	assert.Equal(t, []int{1, 2}, attempts)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	client.Config.RetryMax = 0
+	attempts = nil
+	var retryErr *RetryError
+	assert.True(t, errors.As(client.Call("any.method", struct{}{}, result), &retryErr))
+	assert.True(t, errors.Is(retryErr, injected))
+}
+
+func TestClient_Call_SuccessStatusCodes(t *testing.T) {
+	for _, status := range []int{http.StatusIMUsed, http.StatusConflict} {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.WriteHeader(status)
+			_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {"key": "Value"},"id": "1"}`))
+		}))
+
+		client := apiClient{
+			HTTPClient: server.Client(),
+			Config: &Config{
+				BaseURL:            server.URL,
+				SuccessStatusCodes: []int{http.StatusConflict},
+			},
+		}
+
+		result := &struct {
+			Key string `json:"key"`
+		}{}
+		assert.NoError(t, client.Call("any.method", struct{}{}, result), status)
+		assert.Equal(t, "Value", result.Key, status)
+
+		client.Config.SuccessStatusCodes = nil
+		err := client.Call("any.method", struct{}{}, result)
+		if status == http.StatusConflict {
+			var statusErr *StatusError
+			assert.True(t, errors.As(err, &statusErr))
+			assert.Equal(t, http.StatusConflict, statusErr.StatusCode)
+		} else {
+			assert.NoError(t, err)
+		}
+
+		server.Close()
+	}
+}
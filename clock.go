@@ -0,0 +1,84 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// TimestampHeader carries the Unix time the request is signed at by Config.TimestampSigner
+const TimestampHeader = "X-Timestamp"
+
+// CodeClockSkew is the code of the RPC error the API rejects the request signed too far from its own time with
+const CodeClockSkew = -32010
+
+// TimestampSigner signs request body along with the time it's sent at, so the signature can't be replayed later
+type TimestampSigner func(publicKey, secret string, body []byte, timestamp time.Time) (string, error)
+
+// Hmac256TimestampSigner signs the body prefixed with the Unix timestamp, i.e. "1600000000.{...}", by Hmac256Signer
+func Hmac256TimestampSigner(publicKey, secret string, body []byte, timestamp time.Time) (string, error) {
+	signed := append([]byte(strconv.FormatInt(timestamp.Unix(), 10)+"."), body...)
+	return Hmac256Signer(publicKey, secret, signed)
+}
+
+// clockOffset is the difference between the server and the local time learned from the Date header
+type clockOffset struct {
+	nanos int64 // accessed atomically
+}
+
+// now returns the local time corrected by the offset
+func (o *clockOffset) now() time.Time {
+	if o == nil {
+		return time.Now()
+	}
+
+	return time.Now().Add(time.Duration(atomic.LoadInt64(&o.nanos)))
+}
+
+// resync sets the offset to match the server time given in the Date header
+func (o *clockOffset) resync(date string) (time.Duration, error) {
+	serverTime, err := http.ParseTime(date)
+	if err != nil {
+		return 0, fmt.Errorf("invalid Date header %q: %w", date, err)
+	}
+
+	offset := time.Until(serverTime)
+	if o != nil {
+		atomic.StoreInt64(&o.nanos, int64(offset))
+	}
+
+	return offset, nil
+}
+
+// signTimestamp sets TimestampHeader and returns the signature of the body made along with it
+func (c apiClient) signTimestamp(req *http.Request, publicKey, secret string, body []byte) (string, error) {
+	timestamp := c.clock.now()
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp.Unix(), 10))
+
+	return c.Config.TimestampSigner(publicKey, secret, body, timestamp)
+}
+
+func isClockSkew(err error) bool {
+	var rpcErr *RPCError
+	return errors.As(err, &rpcErr) && rpcErr.Code == CodeClockSkew
+}
+
+// retryClockSkew corrects the clock by the Date header of the rejecting response and repeats the request
+// once signed with the corrected time. The original error is kept if the server time is unknown
+func (c apiClient) retryClockSkew(req *http.Request, body []byte, call *rpcCall, err error) error {
+	offset, resyncErr := c.clock.resync(call.serverDate)
+	if resyncErr != nil {
+		c.log(req.Context(), ErrorLevel, "unable to correct the clock skew of %s: %v", call.info.Method, resyncErr)
+		return err
+	}
+	c.log(req.Context(), WarningLevel, "resigning %s with the clock corrected by %s", call.info.Method, offset)
+
+	if err = c.sign(req, body); err != nil {
+		return err
+	}
+
+	return c.sendRequest(req, call)
+}
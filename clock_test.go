@@ -0,0 +1,86 @@
+package client
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHmac256TimestampSigner(t *testing.T) {
+	timestamp := time.Unix(1600000000, 0)
+	signature, err := Hmac256TimestampSigner("public", "secret", []byte("{}"), timestamp)
+	assert.NoError(t, err)
+
+	expected, err := Hmac256Signer("public", "secret", []byte("1600000000.{}"))
+	assert.NoError(t, err)
+	assert.Equal(t, expected, signature)
+}
+
+// skewedServer accepts the requests signed within a minute of its time which is an hour ahead
+func skewedServer(t *testing.T, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(requests, 1)
+		serverTime := time.Now().Add(time.Hour)
+		rw.Header().Set("Date", serverTime.UTC().Format(http.TimeFormat))
+
+		body, _ := ioutil.ReadAll(req.Body)
+		timestamp, err := strconv.ParseInt(req.Header.Get(TimestampHeader), 10, 64)
+		assert.NoError(t, err)
+		signature, err := Hmac256TimestampSigner("public", "secret", body, time.Unix(timestamp, 0))
+		assert.NoError(t, err)
+		assert.Equal(t, DefaultAuthScheme+" "+signature, req.Header.Get("Authorization"))
+
+		if skew := serverTime.Sub(time.Unix(timestamp, 0)); skew > time.Minute || skew < -time.Minute {
+			_, _ = fmt.Fprintf(rw, `{"jsonrpc": "2.0","error": {"code": %d, "message": "clock skew"},"id": "1"}`, CodeClockSkew)
+			return
+		}
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {"ok": true},"id": "1"}`))
+	}))
+}
+
+func TestTimestampSigner_ClockSkew(t *testing.T) {
+	var requests int32
+	server := skewedServer(t, &requests)
+	defer server.Close()
+
+	config := NewConfig("public", "secret")
+	config.BaseURL = server.URL
+	config.TimestampSigner = Hmac256TimestampSigner
+	client := New(config)
+
+	var result struct{ OK bool }
+	assert.NoError(t, client.Call("any.method", struct{}{}, &result))
+	assert.True(t, result.OK)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	// the corrected clock is kept for the later calls
+	assert.NoError(t, client.Call("any.method", struct{}{}, &result))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+}
+
+func TestTimestampSigner_ClockSkewRetriedOnce(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		rw.Header().Set("Date", time.Now().UTC().Format(http.TimeFormat))
+		_, _ = fmt.Fprintf(rw, `{"jsonrpc": "2.0","error": {"code": %d, "message": "clock skew"},"id": "1"}`, CodeClockSkew)
+	}))
+	defer server.Close()
+
+	config := NewConfig("public", "secret")
+	config.BaseURL = server.URL
+	config.TimestampSigner = Hmac256TimestampSigner
+
+	err := New(config).Call("any.method", struct{}{}, &struct{}{})
+	rpcErr, ok := err.(*RPCError)
+	assert.True(t, ok)
+	assert.Equal(t, CodeClockSkew, rpcErr.Code)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
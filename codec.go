@@ -0,0 +1,192 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+var defaultCodec Codec = JSONCodec{}
+
+// Codec encodes request params and decodes response results
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec is the default codec which relies on encoding/json as is
+type JSONCodec struct{}
+
+// Marshal encodes the value to JSON
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes JSON data into the value
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// SnakeCaseCodec is a JSON codec which maps struct fields without a json tag
+// to snake_case names, e.g. MerchantID is encoded as merchant_id.
+// Explicit json tags are kept as is.
+type SnakeCaseCodec struct{}
+
+// Marshal encodes the value to JSON using snake_case names for untagged fields
+func (SnakeCaseCodec) Marshal(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || v == nil {
+		return data, err
+	}
+
+	generic, err := decodeGeneric(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(renameKeys(generic, reflect.TypeOf(v), true))
+}
+
+// Unmarshal decodes JSON data into the value matching snake_case names to untagged fields
+func (SnakeCaseCodec) Unmarshal(data []byte, v interface{}) error {
+	generic, err := decodeGeneric(data)
+	if err != nil {
+		return err
+	}
+
+	data, err = json.Marshal(renameKeys(generic, reflect.TypeOf(v), false))
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// canonicalJSON re-encodes JSON document with sorted object keys and no insignificant whitespace,
+// so equivalent documents have the same bytes whatever the struct field order is. Numbers are kept as is
+func canonicalJSON(data []byte) ([]byte, error) {
+	generic, err := decodeGeneric(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(generic)
+}
+
+func decodeGeneric(data []byte) (interface{}, error) {
+	var generic interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+
+	return generic, nil
+}
+
+var (
+	marshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// renameKeys walks the generic JSON value along with the Go type it was encoded from (or is decoded to)
+// and renames object keys of untagged struct fields: Go name to snake_case on encoding and back on decoding
+func renameKeys(value interface{}, typ reflect.Type, encode bool) interface{} {
+	for typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ == nil || typ.Implements(marshalerType) || reflect.PtrTo(typ).Implements(unmarshalerType) {
+		return value
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		switch typ.Kind() {
+		case reflect.Struct:
+			fields := map[string]jsonField{}
+			collectFields(typ, fields, encode)
+			renamed := make(map[string]interface{}, len(v))
+			for key, item := range v {
+				if f, ok := fields[key]; ok {
+					renamed[f.name] = renameKeys(item, f.typ, encode)
+				} else {
+					renamed[key] = item
+				}
+			}
+			return renamed
+		case reflect.Map:
+			for key, item := range v {
+				v[key] = renameKeys(item, typ.Elem(), encode)
+			}
+		}
+	case []interface{}:
+		if typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array {
+			for i, item := range v {
+				v[i] = renameKeys(item, typ.Elem(), encode)
+			}
+		}
+	}
+
+	return value
+}
+
+type jsonField struct {
+	name string
+	typ  reflect.Type
+}
+
+// collectFields maps the JSON keys met in the source document to the target key and type of each field
+func collectFields(typ reflect.Type, fields map[string]jsonField, encode bool) {
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name := strings.Split(tag, ",")[0]
+		if name != "" {
+			fields[name] = jsonField{name: name, typ: f.Type}
+			continue
+		}
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && ft.Kind() == reflect.Struct {
+			collectFields(ft, fields, encode)
+			continue
+		}
+
+		if f.PkgPath != "" { // unexported
+			continue
+		}
+
+		if encode {
+			fields[f.Name] = jsonField{name: snakeCase(f.Name), typ: f.Type}
+		} else {
+			fields[snakeCase(f.Name)] = jsonField{name: f.Name, typ: f.Type}
+		}
+	}
+}
+
+// snakeCase converts CamelCase name to snake_case keeping acronyms together, e.g. HTTPTimeout to http_timeout
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+
+	return b.String()
+}
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnakeCaseCodec_Unmarshal(t *testing.T) {
+	result := &struct {
+		MerchantID int
+		Name       string `json:"title"`
+	}{}
+
+	err := SnakeCaseCodec{}.Unmarshal([]byte(`{"merchant_id":1,"title":"City Tours"}`), result)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.MerchantID)
+	assert.Equal(t, "City Tours", result.Name)
+}
+
+func TestSnakeCaseCodec_Marshal(t *testing.T) {
+	type address struct {
+		ZipCode string
+	}
+	params := struct {
+		MerchantID  int
+		HTTPTimeout int `json:"timeout"`
+		Addresses   []address
+	}{
+		MerchantID:  1,
+		HTTPTimeout: 5,
+		Addresses:   []address{{ZipCode: "8000"}},
+	}
+
+	data, err := SnakeCaseCodec{}.Marshal(params)
+
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"merchant_id":1,"timeout":5,"addresses":[{"zip_code":"8000"}]}`, string(data))
+}
+
+func TestSnakeCase(t *testing.T) {
+	assert.Equal(t, "merchant_id", snakeCase("MerchantID"))
+	assert.Equal(t, "http_timeout", snakeCase("HTTPTimeout"))
+	assert.Equal(t, "id", snakeCase("ID"))
+	assert.Equal(t, "name", snakeCase("Name"))
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	canonical, err := canonicalJSON([]byte(`{ "b": [1, {"d": 2, "c": 1.50}], "a": "x" }`))
+
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a":"x","b":[1,{"c":1.50,"d":2}]}`, string(canonical))
+}
+
+func TestClient_Call_CanonicalJSON(t *testing.T) {
+	var signatures []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		signatures = append(signatures, req.Header.Get("Authorization"))
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {},"id": "1"}`))
+	}))
+	defer server.Close()
+
+	config := NewConfig("public", "secret")
+	config.BaseURL = server.URL
+	config.CanonicalJSON = true
+	client := New(config)
+
+	byStruct := struct {
+		Name       string `json:"name"`
+		MerchantID int    `json:"merchant_id"`
+	}{Name: "shop", MerchantID: 1}
+	byMap := map[string]interface{}{"merchant_id": 1, "name": "shop"}
+
+	assert.NoError(t, client.Call("any.method", byStruct, &struct{}{}))
+	assert.NoError(t, client.Call("any.method", byMap, &struct{}{}))
+
+	if assert.Len(t, signatures, 2) {
+		assert.Equal(t, signatures[0], signatures[1])
+	}
+}
@@ -1,33 +1,287 @@
 package client
 
-import "time"
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
 
 var (
 	defaultRetryWaitMin = 1 * time.Second
 	defaultRetryWaitMax = 30 * time.Second
-	defaultRetryMax     = 1
+	defaultRetryMax     = 0 // a single attempt, as RetryMax counts the retries after the first one
 )
 
 // Config is client configuration object
 type Config struct {
-	publicKey    string
-	secret       string
-	BaseURL      string
-	Logger       Logger
-	RetryWaitMin time.Duration // Minimum time to wait
-	RetryWaitMax time.Duration // Maximum time to wait
-	RetryMax     int           // Maximum number of retries
+	publicKey       string
+	secret          string
+	BaseURL         string
+	Logger          Logger
+	Credentials     CredentialProvider // Overrides the credentials given to NewConfig if set
+	AuthScheme      string             // Scheme of the Authorization header, DefaultAuthScheme if empty
+	Codec           Codec              // Params and result codec, JSONCodec if nil
+	RetryWaitMin    time.Duration      // Minimum time to wait
+	RetryWaitMax    time.Duration      // Maximum time to wait
+	RetryMax        int                // Maximum number of retries after the first attempt, zero disables retries
+	BackoffStrategy string             // Backoff name: exponential (default), linear, constant or none
+	FirstRetry      FirstRetry         // Wait before the first retry, the backoff applies afterwards
+	Retryer         RequestRetryer     // Overrides the retry settings above if set
+	// CircuitBreakerThreshold is the number of consecutive failed attempts stopping all calls, disabled if zero
+	CircuitBreakerThreshold int
+	CircuitBreakerCooldown  time.Duration // Time calls are rejected for once the circuit opens, 30s if zero
+	// FailOnRetryAfterDeadline makes the call fail with ErrRetryAfterExceedsDeadline right away if the response
+	// asks to retry after the context deadline, instead of waiting for the deadline to pass
+	FailOnRetryAfterDeadline bool
+	// RetryUntilDeadline ignores RetryMax for calls with the context deadline and retries them
+	// as long as the next attempt starts before the deadline
+	RetryUntilDeadline bool
+	// NonRetryableMethods are attempted just once whatever the retry settings are, e.g. non-idempotent payment methods
+	NonRetryableMethods []string
+	// OnUnauthorized is called on 401 response to refresh the credentials, the call is then repeated once
+	OnUnauthorized func(ctx context.Context) error
+	// RetryWhileEmpty repeats the call while the decoded result is empty, e.g. for eventually consistent reads
+	// right after a write. The retryer limits the repeated attempts along with the failed ones
+	RetryWhileEmpty func(result interface{}) bool
+	// SuccessPredicate rejects 2xx response by returning an error, e.g. for gateways responding 200 with error pages.
+	// The response is retried if the error wraps ErrRetryableResponse
+	SuccessPredicate func(resp *http.Response, body []byte) error
+	// RetryOnBodyMatch retries 2xx response if it's true for the body, e.g. for backend saturation reported in the payload.
+	// It's given up to 64KB of the body
+	RetryOnBodyMatch func(body []byte) bool
+	// RetryableRPCError decides whether to repeat the call failed with the RPC error, the retryer limits the attempts
+	RetryableRPCError func(*RPCError) bool
+
+	MaxConcurrentRequests int            // Maximum number of requests in flight, unlimited if zero
+	DeadlineFormat        DeadlineFormat // Format of X-Request-Deadline header
+	AttemptHeader         string         // Header to send the attempt number in starting from 1, disabled if empty
+	OnComplete            func(CallInfo) // Called once the call is completed
+	EncodeMethodInPath    bool           // Append the method to the URL path for gateways routing by path
+	ResponseCache         ResponseCache  // Cache of ETag tagged results, disabled if nil
+	CacheableMethods      []string       // Idempotent methods to cache results of
+	ServeStaleOnError     bool           // Serve the cached result if the call fails, see ErrStaleResult
+	RequireJSONRPCField   bool           // Reject responses without jsonrpc member, e.g. misrouted gateway pages
+	CanonicalJSON         bool           // Send and sign bodies with sorted keys, so signatures don't depend on field order
+	BatchSigning          BatchSigning   // How batch requests are signed, the whole body only by default
+	IDGenerator           IDGenerator    // Generates ids of requests given without one, "1" is sent if nil
+	IDType                IDType         // JSON type of the request id, IDTypeString by default
+	// UnwrapDoubleEncodedResult decodes the result given as a JSON string containing JSON object or array
+	UnwrapDoubleEncodedResult bool
+
+	HTTPTimeout time.Duration // Time limit of a single HTTP request, DefaultHTTPTimeout if zero
+	LocalAddr   string        // Local IP address to send requests from
+	// TLSHandshakeTimeout, ResponseHeaderTimeout and ExpectContinueTimeout limit the stages of a single HTTP request
+	// within HTTPTimeout, e.g. to fail fast on a hung handshake while allowing a long body download.
+	// The defaults of http.DefaultTransport apply if zero
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	ExpectContinueTimeout time.Duration
+	// DialContext overrides how connections are made, e.g. for DNS caching. LocalAddr is ignored if set
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+	// MethodTimeouts limits the whole call of the method including retries, HTTPTimeout still applies to each attempt
+	MethodTimeouts map[string]time.Duration
+	// RequireHTTPS rejects base URLs sending signed payloads in cleartext, loopback hosts are exempted.
+	// Validate checks the base URL, and the requests to other URLs fail with ErrInsecureURL before they're sent
+	RequireHTTPS bool
+	// MaxResponseBytes limits the decompressed response body, e.g. against gzip bombs, unlimited if zero.
+	// NewConfig sets DefaultMaxResponseBytes, raise it for CallStream calls of bigger results
+	MaxResponseBytes int64
+	// AuditHook is given the exact bytes sent and received by every attempt. It exposes signatures and payloads,
+	// so it's disabled if nil
+	AuditHook func(audit AuditEvent)
+	// Accept is the Accept header value for gateways negotiating the content strictly, DefaultAccept if empty.
+	// Set to OmitAccept to send no Accept header
+	Accept string
+	// ParamsEncryptor transforms the request body before it's signed, e.g. to encrypt card data client-side.
+	// It's given the whole JSON-RPC request and must return a valid JSON. Batches are sent as is
+	ParamsEncryptor func(method string, body []byte) ([]byte, error)
+	// DecodeResultWithError decodes the partial result some methods respond along with the error,
+	// the call still returns the RPC error
+	DecodeResultWithError bool
+	// MethodPrefix is prepended to the methods as is, e.g. "merchant." for clients of a single namespace.
+	// Methods containing a dot are considered qualified and left intact unless PrefixQualifiedMethods is set
+	MethodPrefix           string
+	PrefixQualifiedMethods bool
+	// BatchResultFactory allocates the target to decode the result of the batch call given without BatchCall.Result,
+	// e.g. by the method for heterogeneous batches
+	BatchResultFactory func(method, id string) interface{}
+	// TimestampSigner signs requests instead of RequestSigner along with the time sent in TimestampHeader.
+	// The request rejected with CodeClockSkew is signed once again with the clock corrected by the server Date header
+	TimestampSigner TimestampSigner
+	// VersionHeader is the response header compared with the version the request is sent to, DefaultVersionHeader if empty.
+	// The mismatch is logged as a warning
+	VersionHeader string
+	// FaultInjector is meant for tests only, e.g. of the fallbacks of the caller. It's consulted before every attempt
+	// and the error it returns fails the attempt as a transport error would, so the request isn't sent
+	FaultInjector func(attempt int) error
+	// SuccessStatusCodes are treated as success in addition to 2xx, e.g. the ones some gateways respond with
+	SuccessStatusCodes []int
+	// MaxRetryAfter limits the wait asked by Retry-After header, RetryWaitMax if zero. The limit applies to the waits
+	// of the calls, PreviewBackoff and the retryers return the delays as asked
+	MaxRetryAfter time.Duration
+	// TrackConnectionPool counts the connections of the transport built from the config, see PoolStats
+	TrackConnectionPool bool
+	// StreamBatchBody encodes batch calls while the body is sent instead of buffering the whole batch, e.g. for
+	// batches of thousands of calls. The signature can't be computed before the body is sent, so it goes in
+	// the Authorization trailer of the chunked request, which the server has to support. The body is signed as
+	// Hmac256Signer does, so the batch fails if any other signer is set. The body is neither logged nor teed
+	StreamBatchBody bool
+	// NewRetryer creates the retryer of every call, so stateful retryers, e.g. adaptive backoffs, keep
+	// their state per call and a slow call doesn't penalize the next one. It takes precedence over Retryer
+	NewRetryer func() RequestRetryer
+	// MaxResponseDepth limits the nesting of arrays and objects of the response, DefaultMaxResponseDepth if zero
+	MaxResponseDepth int
+}
+
+// CredentialProvider supplies the credentials to sign every request with, e.g. to pick up rotated keys
+type CredentialProvider interface {
+	Credentials(ctx context.Context) (publicKey, secret string, err error)
 }
 
 // NewConfig initializes a client configuration
 func NewConfig(publicKey, secret string) *Config {
 	return &Config{
-		publicKey:    publicKey,
-		secret:       secret,
-		BaseURL:      BaseURLV3,
-		Logger:       NewNullLogger(),
-		RetryWaitMin: defaultRetryWaitMin,
-		RetryWaitMax: defaultRetryWaitMax,
-		RetryMax:     defaultRetryMax,
+		publicKey:        publicKey,
+		secret:           secret,
+		BaseURL:          BaseURLV3,
+		Logger:           NewNullLogger(),
+		RetryWaitMin:     defaultRetryWaitMin,
+		RetryWaitMax:     defaultRetryWaitMax,
+		RetryMax:         defaultRetryMax,
+		HTTPTimeout:      DefaultHTTPTimeout,
+		MaxResponseBytes: DefaultMaxResponseBytes,
+	}
+}
+
+// Environment variables read by NewConfigFromEnv
+const (
+	EnvPublicKey = "PAYYO_PUBLIC_KEY"
+	EnvSecret    = "PAYYO_SECRET"
+	EnvBaseURL   = "PAYYO_BASE_URL"  // Optional, BaseURLV3 by default
+	EnvRetryMax  = "PAYYO_RETRY_MAX" // Optional
+)
+
+// NewConfigFromEnv initializes a client configuration from the environment variables
+func NewConfigFromEnv() (*Config, error) {
+	var missing []string
+	for _, name := range []string{EnvPublicKey, EnvSecret} {
+		if os.Getenv(name) == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing environment variables: %s", strings.Join(missing, ", "))
+	}
+
+	config := NewConfig(os.Getenv(EnvPublicKey), os.Getenv(EnvSecret))
+
+	if baseURL := os.Getenv(EnvBaseURL); baseURL != "" {
+		config.BaseURL = baseURL
+	}
+
+	if retryMax := os.Getenv(EnvRetryMax); retryMax != "" {
+		value, err := strconv.Atoi(retryMax)
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("%s must be a non-negative integer, got %q", EnvRetryMax, retryMax)
+		}
+		config.RetryMax = value
+	}
+
+	return config, nil
+}
+
+// clone returns the copy of the config which doesn't share slices and maps with the original one.
+// Hooks and interfaces, e.g. Logger or ResponseCache, are shared as is
+func (c *Config) clone() *Config {
+	clone := *c
+
+	clone.NonRetryableMethods = append([]string(nil), c.NonRetryableMethods...)
+	clone.CacheableMethods = append([]string(nil), c.CacheableMethods...)
+	clone.SuccessStatusCodes = append([]int(nil), c.SuccessStatusCodes...)
+	if c.MethodTimeouts != nil {
+		clone.MethodTimeouts = make(map[string]time.Duration, len(c.MethodTimeouts))
+		for method, timeout := range c.MethodTimeouts {
+			clone.MethodTimeouts[method] = timeout
+		}
+	}
+
+	return &clone
+}
+
+// Validate checks the configuration is consistent
+func (c *Config) Validate() error {
+	if _, ok := backoffStrategies[c.BackoffStrategy]; !ok {
+		return fmt.Errorf("unknown backoff strategy %q", c.BackoffStrategy)
 	}
+
+	if c.LocalAddr != "" && net.ParseIP(c.LocalAddr) == nil {
+		return fmt.Errorf("local address %q is not a valid IP", c.LocalAddr)
+	}
+
+	if c.RequireHTTPS {
+		if err := requireHTTPS(c.BaseURL); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// requireHTTPS checks the base URL uses https unless it points to the local machine
+func requireHTTPS(baseURL string) error {
+	parsed, err := url.Parse(baseURL)
+	if err != nil {
+		return fmt.Errorf("invalid base URL %q: %w", baseURL, err)
+	}
+
+	if isInsecureURL(parsed) {
+		return fmt.Errorf("base URL %q must use https", baseURL)
+	}
+
+	return nil
+}
+
+// isInsecureURL reports whether the URL is neither https nor points to the local machine
+func isInsecureURL(u *url.URL) bool {
+	if u.Scheme == "https" {
+		return false
+	}
+
+	host := u.Hostname()
+	ip := net.ParseIP(host)
+
+	return host != "localhost" && (ip == nil || !ip.IsLoopback())
+}
+
+// String returns a printable representation of the config which doesn't expose credentials.
+// It covers the settings of the connection, the retries and the limits, the hooks and the custom
+// implementations, e.g. Retryer or Codec, are omitted
+func (c *Config) String() string {
+	return fmt.Sprintf(
+		"Config{PublicKey: %s, Secret: %s, BaseURL: %s, AuthScheme: %s, RetryWaitMin: %s, RetryWaitMax: %s, RetryMax: %d, "+
+			"BackoffStrategy: %s, FirstRetry: %d, RetryUntilDeadline: %t, MaxRetryAfter: %s, CircuitBreakerThreshold: %d, "+
+			"HTTPTimeout: %s, MaxConcurrentRequests: %d, MaxResponseBytes: %d, RequireHTTPS: %t}",
+		maskString(c.publicKey, 4), maskString(c.secret, 0), c.BaseURL, c.AuthScheme, c.RetryWaitMin, c.RetryWaitMax, c.RetryMax,
+		c.BackoffStrategy, c.FirstRetry, c.RetryUntilDeadline, c.MaxRetryAfter, c.CircuitBreakerThreshold,
+		c.HTTPTimeout, c.MaxConcurrentRequests, c.MaxResponseBytes, c.RequireHTTPS,
+	)
+}
+
+// maskString hides all but the first visible characters of the value
+func maskString(value string, visible int) string {
+	if value == "" {
+		return ""
+	}
+
+	if len(value) <= visible*2 {
+		visible = 0
+	}
+
+	return value[:visible] + strings.Repeat("*", 8)
 }
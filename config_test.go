@@ -1,8 +1,17 @@
 package client
 
 import (
-	"github.com/stretchr/testify/assert"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestNewConfig(t *testing.T) {
@@ -12,3 +21,179 @@ func TestNewConfig(t *testing.T) {
 	assert.Equal(t, "secret", cfg.secret)
 	assert.Equal(t, "https://api.client.ch/v3", cfg.BaseURL)
 }
+
+// setEnv sets the environment variables and returns the function restoring them
+func setEnv(vars map[string]string) func() {
+	for _, name := range []string{EnvPublicKey, EnvSecret, EnvBaseURL, EnvRetryMax} {
+		_ = os.Unsetenv(name)
+	}
+	for name, value := range vars {
+		_ = os.Setenv(name, value)
+	}
+
+	return func() {
+		for name := range vars {
+			_ = os.Unsetenv(name)
+		}
+	}
+}
+
+func TestNewConfigFromEnv(t *testing.T) {
+	defer setEnv(map[string]string{
+		EnvPublicKey: "key",
+		EnvSecret:    "secret",
+		EnvBaseURL:   BaseURLV4,
+		EnvRetryMax:  "3",
+	})()
+
+	cfg, err := NewConfigFromEnv()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "key", cfg.publicKey)
+	assert.Equal(t, "secret", cfg.secret)
+	assert.Equal(t, BaseURLV4, cfg.BaseURL)
+	assert.Equal(t, 3, cfg.RetryMax)
+	assert.Equal(t, DefaultHTTPTimeout, cfg.HTTPTimeout)
+}
+
+func TestNewConfigFromEnv_Defaults(t *testing.T) {
+	defer setEnv(map[string]string{EnvPublicKey: "key", EnvSecret: "secret"})()
+
+	cfg, err := NewConfigFromEnv()
+
+	assert.NoError(t, err)
+	assert.Equal(t, BaseURLV3, cfg.BaseURL)
+	assert.Equal(t, defaultRetryMax, cfg.RetryMax)
+}
+
+func TestNewConfigFromEnv_Missing(t *testing.T) {
+	defer setEnv(map[string]string{EnvPublicKey: "key"})()
+
+	_, err := NewConfigFromEnv()
+
+	assert.EqualError(t, err, "missing environment variables: PAYYO_SECRET")
+}
+
+func TestNewConfigFromEnv_InvalidRetryMax(t *testing.T) {
+	defer setEnv(map[string]string{EnvPublicKey: "key", EnvSecret: "secret", EnvRetryMax: "many"})()
+
+	_, err := NewConfigFromEnv()
+
+	assert.EqualError(t, err, `PAYYO_RETRY_MAX must be a non-negative integer, got "many"`)
+}
+
+func TestConfig_String(t *testing.T) {
+	cfg := NewConfig("public-key", "top-secret")
+	cfg.RetryMax = 5
+	cfg.BackoffStrategy = BackoffLinear
+	cfg.RequireHTTPS = true
+
+	str := cfg.String()
+
+	assert.NotContains(t, str, "top-secret")
+	assert.NotContains(t, str, "public-key")
+	assert.Contains(t, str, "PublicKey: publ********")
+	assert.Contains(t, str, "Secret: ********")
+	assert.Contains(t, str, "BaseURL: https://api.client.ch/v3")
+	assert.Contains(t, str, "RetryMax: 5")
+	assert.Contains(t, str, "BackoffStrategy: linear")
+	assert.Contains(t, str, "HTTPTimeout: "+DefaultHTTPTimeout.String())
+	assert.Contains(t, str, "RequireHTTPS: true")
+}
+
+func TestConfig_Validate(t *testing.T) {
+	cfg := NewConfig("key", "secret")
+	assert.NoError(t, cfg.Validate())
+
+	for _, name := range []string{"exponential", "linear", "constant", "none"} {
+		cfg.BackoffStrategy = name
+		assert.NoError(t, cfg.Validate())
+	}
+
+	cfg.BackoffStrategy = "fibonacci"
+	assert.EqualError(t, cfg.Validate(), `unknown backoff strategy "fibonacci"`)
+}
+
+func TestConfig_Validate_LocalAddr(t *testing.T) {
+	cfg := NewConfig("key", "secret")
+
+	cfg.LocalAddr = "10.0.0.1"
+	assert.NoError(t, cfg.Validate())
+
+	cfg.LocalAddr = "eth0"
+	assert.EqualError(t, cfg.Validate(), `local address "eth0" is not a valid IP`)
+}
+
+func TestConfig_Validate_RequireHTTPS(t *testing.T) {
+	cfg := NewConfig("public", "secret")
+	cfg.BaseURL = "http://api.client.ch/v3"
+	assert.NoError(t, cfg.Validate())
+
+	cfg.RequireHTTPS = true
+	assert.EqualError(t, cfg.Validate(), `base URL "http://api.client.ch/v3" must use https`)
+
+	cfg.BaseURL = BaseURLV3
+	assert.NoError(t, cfg.Validate())
+
+	cfg.BaseURL = "http://localhost:8080/v3"
+	assert.NoError(t, cfg.Validate())
+
+	cfg.BaseURL = "http://127.0.0.1:8080/v3"
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestClient_Call_RequireHTTPS(t *testing.T) {
+	var requests int
+	cfg := NewConfig("public", "secret")
+	cfg.BaseURL = "http://api.client.ch/v3"
+	cfg.RequireHTTPS = true
+	client := New(cfg, WithTransport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requests++
+		return nil, errors.New("unexpected request")
+	})))
+
+	err := client.Call("any.method", struct{}{}, nil)
+	assert.True(t, errors.Is(err, ErrInsecureURL), "unexpected error: %v", err)
+
+	_, err = client.(Diagnoser).Diagnose(context.Background())
+	assert.True(t, errors.Is(err, ErrInsecureURL), "unexpected error: %v", err)
+	assert.Zero(t, requests)
+}
+
+func TestNew_SharedConfig(t *testing.T) {
+	var methods sync.Map
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var request struct{ Method string }
+		_ = json.NewDecoder(req.Body).Decode(&request)
+		methods.Store(request.Method, true)
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {},"id": "1"}`))
+	}))
+	defer server.Close()
+
+	cfg := NewConfig("key", "secret")
+	cfg.BaseURL = server.URL
+	cfg.MethodTimeouts = map[string]time.Duration{"any.method": time.Second}
+	clients := []Client{New(cfg), New(cfg)}
+
+	var wg sync.WaitGroup
+	for _, c := range clients {
+		wg.Add(1)
+		go func(c Client) {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				assert.NoError(t, c.Call("any.method", struct{}{}, &struct{}{}))
+			}
+		}(c)
+	}
+
+	// the race detector reports the mutations if the clients read the shared config
+	for i := 0; i < 10; i++ {
+		cfg.MethodPrefix = "merchant."
+		cfg.AuthScheme = "Signature"
+		cfg.MethodTimeouts["any.method"] = time.Duration(i)
+	}
+	wg.Wait()
+
+	_, prefixed := methods.Load("merchant.any.method")
+	assert.False(t, prefixed, "the clients don't see the later changes")
+}
@@ -0,0 +1,18 @@
+//go:build go1.18
+// +build go1.18
+
+package client
+
+import "testing"
+
+// FuzzDecodeResponse feeds arbitrary bodies to every decode path: plain, streamed and batched results.
+// Fuzzing needs Go 1.18, older versions run the seeds by TestDecodeResponse_Seeds
+func FuzzDecodeResponse(f *testing.F) {
+	for _, seed := range fuzzResponseSeeds {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		decodeAll(body)
+	})
+}
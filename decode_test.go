@@ -0,0 +1,107 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var fuzzResponseSeeds = []string{
+	`{"jsonrpc": "2.0","result": {"key": "Value"},"id": "1"}`,
+	`{"jsonrpc": "2.0","result": "{\"key\": \"Value\"}","id": "1"}`,
+	`{"jsonrpc": "2.0","result": [1, 2, 3],"id": "1"}`,
+	`{"jsonrpc": "2.0","error": {"code": -32601, "message": "Method not found"},"id": "1"}`,
+	`{"jsonrpc": "2.0","result": 1e999999,"id": "1"}`,
+	`{"jsonrpc": "2.0","result": {"key": "a", "key": "b"},"id": "1", "id": "2"}`,
+	`[{"jsonrpc": "2.0","result": 1,"id": "1"}, {"jsonrpc": "2.0","result": 2,"id": "1"}]`,
+	`{"result": [[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[`,
+	`{"result": {"merchant_id": {"merchant_id": {"merchant_id": null}}}}`,
+	`{"jsonrpc": "2.0","result": "` + strings.Repeat(`[`, 1000) + `","id": "1"}`,
+	`{"jsonrpc": "2.0","result": ` + strings.Repeat(`[`, 1000) + strings.Repeat(`]`, 1000) + `,"id": "1"}`,
+	`null`,
+	``,
+}
+
+// fuzzClient returns the client which receives the body as the response to every request
+func fuzzClient(body []byte) apiClient {
+	return apiClient{
+		HTTPClient: &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{},
+				Body:       ioutil.NopCloser(bytes.NewReader(body)),
+				Request:    req,
+			}, nil
+		})},
+		Config: &Config{
+			BaseURL:                   "http://localhost",
+			Codec:                     SnakeCaseCodec{},
+			UnwrapDoubleEncodedResult: true,
+		},
+	}
+}
+
+type fuzzResult struct {
+	MerchantID *fuzzResult
+	Key        string `json:"key"`
+	Items      []map[string]interface{}
+}
+
+// decodeAll decodes the body by every decode path: plain, streamed and batched results
+func decodeAll(body []byte) []error {
+	client := fuzzClient(body)
+
+	return []error{
+		client.Call("any.method", struct{}{}, &fuzzResult{}),
+		client.Call("any.method", struct{}{}, new(interface{})),
+		client.CallStream(context.Background(), "any.method", nil, func(item json.RawMessage) error {
+			return nil
+		}),
+		client.CallBatch(context.Background(), []*BatchCall{
+			{Request: Request{Method: "any.method"}, Result: &fuzzResult{}},
+			{Request: Request{Method: "any.method"}, Result: new(interface{})},
+		}),
+	}
+}
+
+func TestDecodeResponse_Seeds(t *testing.T) {
+	for _, seed := range fuzzResponseSeeds {
+		assert.NotPanics(t, func() { decodeAll([]byte(seed)) }, "seed %.80s", seed)
+	}
+}
+
+func TestClient_Call_MaxResponseDepth(t *testing.T) {
+	nested := func(depth int) []byte {
+		return []byte(`{"jsonrpc": "2.0","result": ` + strings.Repeat(`[`, depth) + strings.Repeat(`]`, depth) + `,"id": "1"}`)
+	}
+
+	// the envelope object counts as well
+	for _, err := range decodeAll(nested(DefaultMaxResponseDepth - 1)) {
+		assert.False(t, errors.Is(err, ErrResponseTooDeep), "unexpected error: %v", err)
+	}
+	for _, err := range decodeAll(nested(DefaultMaxResponseDepth)) {
+		assert.True(t, errors.Is(err, ErrResponseTooDeep), "unexpected error: %v", err)
+	}
+
+	client := fuzzClient(nested(10))
+	client.Config.MaxResponseDepth = 5
+	err := client.Call("any.method", struct{}{}, new(interface{}))
+	assert.True(t, errors.Is(err, ErrResponseTooDeep), "unexpected error: %v", err)
+
+	// the double encoded result is checked once unwrapped, the brackets of the strings don't count
+	client = fuzzClient([]byte(`{"jsonrpc": "2.0","result": "[[[[[[[\"]]]]]]]]]]]]]\"]]]]]]]","id": "1"}`))
+	client.Config.MaxResponseDepth = 5
+	err = client.Call("any.method", struct{}{}, new(interface{}))
+	assert.True(t, errors.Is(err, ErrResponseTooDeep), "unexpected error: %v", err)
+}
+
+func TestNewConfig_MaxResponseBytes(t *testing.T) {
+	assert.Equal(t, int64(DefaultMaxResponseBytes), NewConfig("public", "secret").MaxResponseBytes)
+}
@@ -0,0 +1,135 @@
+package client
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ErrResponseTooLarge is returned when the decompressed response body exceeds Config.MaxResponseBytes
+var ErrResponseTooLarge = errors.New("response body is too large")
+
+// ErrResponseTooDeep is returned when the arrays and objects of the response are nested deeper than
+// Config.MaxResponseDepth
+var ErrResponseTooDeep = errors.New("response body is nested too deep")
+
+// DefaultMaxResponseBytes is the limit of the decompressed response body set by NewConfig
+const DefaultMaxResponseBytes = 32 << 20
+
+// DefaultMaxResponseDepth is the nesting limit of the response used if Config.MaxResponseDepth is zero
+const DefaultMaxResponseDepth = 100
+
+// responseBody returns the decompressed response body limited to Config.MaxResponseBytes.
+// The transport decompresses gzip transparently unless it's disabled or the server compresses unasked,
+// so the body still encoded is decompressed here. The limit applies to the decompressed bytes either way.
+// It's applied once right after the response is received, so all hooks read the body it returns
+func (c apiClient) responseBody(resp *http.Response) (io.ReadCloser, error) {
+	body := resp.Body
+	var reader io.Reader = body
+
+	if resp.ContentLength != 0 && strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = gz
+
+		// the body is decompressed just once, as the transport does it
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+	}
+
+	if c.Config.MaxResponseBytes > 0 {
+		reader = &maxBytesReader{reader: reader, remaining: c.Config.MaxResponseBytes}
+	}
+
+	return &replayBody{Reader: reader, Closer: body}, nil
+}
+
+// maxBytesReader fails with ErrResponseTooLarge instead of silently truncating the body like io.LimitReader
+type maxBytesReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (r *maxBytesReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		// the body may end exactly at the limit, so one more byte is probed
+		var probe [1]byte
+		n, err := r.reader.Read(probe[:])
+		if n > 0 {
+			return 0, ErrResponseTooLarge
+		}
+		return 0, err
+	}
+
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.reader.Read(p)
+	r.remaining -= int64(n)
+
+	return n, err
+}
+
+// maxResponseDepth returns the nesting limit of the response
+func (c apiClient) maxResponseDepth() int {
+	if c.Config.MaxResponseDepth > 0 {
+		return c.Config.MaxResponseDepth
+	}
+
+	return DefaultMaxResponseDepth
+}
+
+// depthLimitReader fails with ErrResponseTooDeep once the JSON read is nested deeper than the limit,
+// so the decoders don't recurse into adversarial bodies
+type depthLimitReader struct {
+	reader  io.Reader
+	scanner depthScanner
+}
+
+func (r *depthLimitReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if scanErr := r.scanner.scan(p[:n]); scanErr != nil {
+		return 0, scanErr
+	}
+
+	return n, err
+}
+
+// depthScanner tracks the nesting of JSON given in chunks skipping the brackets within strings
+type depthScanner struct {
+	max      int
+	depth    int
+	inString bool
+	escaped  bool
+}
+
+func (s *depthScanner) scan(data []byte) error {
+	for _, b := range data {
+		switch {
+		case s.escaped:
+			s.escaped = false
+		case s.inString:
+			if b == '\\' {
+				s.escaped = true
+			} else if b == '"' {
+				s.inString = false
+			}
+		case b == '"':
+			s.inString = true
+		case b == '{' || b == '[':
+			if s.depth++; s.depth > s.max {
+				return ErrResponseTooDeep
+			}
+		case b == '}' || b == ']':
+			s.depth--
+		}
+	}
+
+	return nil
+}
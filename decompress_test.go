@@ -0,0 +1,102 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// gzipBomb returns a small gzip payload of the response which decompresses to over 1MB
+func gzipBomb(t *testing.T) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte(`{"jsonrpc": "2.0","result": "` + strings.Repeat("a", 1<<20) + `","id": "1"}`))
+	assert.NoError(t, err)
+	assert.NoError(t, gz.Close())
+	assert.Less(t, buf.Len(), 4096)
+
+	return buf.Bytes()
+}
+
+func TestClient_Call_MaxResponseBytes(t *testing.T) {
+	payload := gzipBomb(t)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Encoding", "gzip")
+		_, _ = rw.Write(payload)
+	}))
+	defer server.Close()
+
+	for name, disableCompression := range map[string]bool{"transport": false, "client": true} {
+		t.Run(name, func(t *testing.T) {
+			httpClient := server.Client()
+			httpClient.Transport.(*http.Transport).DisableCompression = disableCompression
+
+			client := apiClient{
+				HTTPClient: httpClient,
+				Config: &Config{
+					BaseURL:          server.URL,
+					MaxResponseBytes: 64 << 10,
+				},
+			}
+
+			var result string
+			err := client.Call("any.method", struct{}{}, &result)
+			assert.True(t, errors.Is(err, ErrResponseTooLarge), "unexpected error: %v", err)
+
+			client.Config.MaxResponseBytes = 2 << 20
+			assert.NoError(t, client.Call("any.method", struct{}{}, &result))
+			assert.Len(t, result, 1<<20)
+		})
+	}
+}
+
+func TestClient_Call_SuccessPredicateReadsLimitedBody(t *testing.T) {
+	payload := gzipBomb(t)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Encoding", "gzip")
+		_, _ = rw.Write(payload)
+	}))
+	defer server.Close()
+
+	httpClient := server.Client()
+	httpClient.Transport.(*http.Transport).DisableCompression = true
+
+	var predicateCalls int
+	client := apiClient{
+		HTTPClient: httpClient,
+		Config: &Config{
+			BaseURL:          server.URL,
+			MaxResponseBytes: 2 << 20,
+			SuccessPredicate: func(resp *http.Response, body []byte) error {
+				predicateCalls++
+				assert.True(t, bytes.HasPrefix(body, []byte(`{"jsonrpc"`)), "the predicate reads the decompressed body")
+				return nil
+			},
+		},
+	}
+
+	var result string
+	assert.NoError(t, client.Call("any.method", struct{}{}, &result))
+	assert.Len(t, result, 1<<20)
+
+	client.Config.MaxResponseBytes = 64 << 10
+	err := client.Call("any.method", struct{}{}, &result)
+	assert.True(t, errors.Is(err, ErrResponseTooLarge), "unexpected error: %v", err)
+	assert.Equal(t, 1, predicateCalls, "the predicate isn't given the body over the limit")
+}
+
+func TestMaxBytesReader_ExactLimit(t *testing.T) {
+	reader := &maxBytesReader{reader: strings.NewReader("12345"), remaining: 5}
+
+	var buf bytes.Buffer
+	_, err := buf.ReadFrom(reader)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "12345", buf.String())
+}
@@ -0,0 +1,141 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// DiagnoseMethod is called by Diagnose. The server doesn't have to implement it,
+// the RPC error response proves the connectivity and the credentials as well
+const DiagnoseMethod = "rpc.ping"
+
+// DiagnosticReport describes the timings of the single request made by Diagnose
+type DiagnosticReport struct {
+	DNS              time.Duration // Zero if the host is an IP or the connection was reused
+	Connect          time.Duration
+	TLSHandshake     time.Duration // Zero for plain HTTP
+	TimeToFirstByte  time.Duration // Since the request has started
+	Total            time.Duration // Including reading the response body
+	ReusedConnection bool
+	StatusCode       int
+	Authorized       bool // The server has accepted the signature
+}
+
+// Diagnoser is implemented by clients able to check the connectivity to the API
+type Diagnoser interface {
+	Diagnose(ctx context.Context) (DiagnosticReport, error)
+}
+
+var _ Diagnoser = apiClient{}
+
+// Diagnose makes a single signed request to the API reporting the time spent on every phase of it.
+// The method, the URL and the body are built as for any call. The error is returned only if there was no response
+func (c apiClient) Diagnose(ctx context.Context) (DiagnosticReport, error) {
+	var report DiagnosticReport
+
+	method := c.qualifiedMethod(DiagnoseMethod)
+	body, _, _, err := c.encodeRequest(Request{Method: method, Params: struct{}{}})
+	if err != nil {
+		return report, err
+	}
+
+	// the transport may call the hooks from its own goroutines, e.g. dialing in parallel
+	var mu sync.Mutex
+	record := func(update func()) {
+		mu.Lock()
+		defer mu.Unlock()
+		update()
+	}
+
+	var dnsStart, connectStart, tlsStart time.Time
+	start := time.Now()
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { record(func() { dnsStart = time.Now() }) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { record(func() { report.DNS = time.Since(dnsStart) }) },
+		ConnectStart: func(string, string) {
+			record(func() { connectStart = time.Now() })
+		},
+		ConnectDone: func(string, string, error) {
+			record(func() { report.Connect = time.Since(connectStart) })
+		},
+		TLSHandshakeStart: func() { record(func() { tlsStart = time.Now() }) },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			record(func() { report.TLSHandshake = time.Since(tlsStart) })
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			record(func() { report.ReusedConnection = info.Reused })
+		},
+		GotFirstResponseByte: func() {
+			record(func() { report.TimeToFirstByte = time.Since(start) })
+		},
+	}
+
+	ctx = httptrace.WithClientTrace(ctx, trace)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint(method, ""), bytes.NewReader(body))
+	if err != nil {
+		return report, err
+	}
+
+	if err = c.checkHTTPS(req); err != nil {
+		return report, err
+	}
+
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	c.setAccept(req)
+	if err = c.sign(req, body); err != nil {
+		return report, err
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		mu.Lock()
+		defer mu.Unlock()
+		report.Total = time.Since(start)
+		return report, err
+	}
+	c.drainBody(ctx, resp.Body)
+
+	mu.Lock()
+	defer mu.Unlock()
+	report.Total = time.Since(start)
+	report.StatusCode = resp.StatusCode
+	report.Authorized = resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusForbidden
+
+	return report, nil
+}
+
+// ErrInvalidCredentials is returned by VerifyCredentials if the server has rejected the signature
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// CredentialsVerifier is implemented by clients able to check the credentials without calling a business method
+type CredentialsVerifier interface {
+	VerifyCredentials(ctx context.Context) error
+}
+
+var _ CredentialsVerifier = apiClient{}
+
+// VerifyCredentials calls DiagnoseMethod to check the server accepts the signature. The RPC error is fine,
+// e.g. if the server doesn't implement the method, while 401 and 403 responses fail with ErrInvalidCredentials
+func (c apiClient) VerifyCredentials(ctx context.Context) error {
+	var result json.RawMessage
+	err := c.call(ctx, Request{Method: DiagnoseMethod, Params: struct{}{}}, &rpcCall{result: &result})
+
+	var rpcErr *RPCError
+	var statusErr *StatusError
+	switch {
+	case err == nil, errors.As(err, &rpcErr):
+		return nil
+	case errors.As(err, &statusErr) && (statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden):
+		return fmt.Errorf("%w: %s", ErrInvalidCredentials, statusErr.Status)
+	default:
+		return err
+	}
+}
@@ -0,0 +1,130 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_Diagnose(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		if valid, _ := VerifySignature("public", "secret", body, req.Header.Get("Authorization")); !valid {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","error": {"code": -32601, "message": "Method not found"},"id": "1"}`))
+	}))
+	defer server.Close()
+
+	for secret, authorized := range map[string]bool{"secret": true, "wrong": false} {
+		client := apiClient{
+			HTTPClient: server.Client(),
+			Config:     &Config{BaseURL: server.URL, publicKey: "public", secret: secret},
+		}
+		client.HTTPClient.CloseIdleConnections()
+
+		report, err := client.Diagnose(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, authorized, report.Authorized)
+		assert.False(t, report.ReusedConnection)
+		assert.Greater(t, int64(report.Connect), int64(0))
+		assert.Greater(t, int64(report.TLSHandshake), int64(0))
+		assert.Greater(t, int64(report.TimeToFirstByte), int64(0))
+		assert.GreaterOrEqual(t, int64(report.Total), int64(report.TimeToFirstByte))
+		if authorized {
+			assert.Equal(t, http.StatusOK, report.StatusCode)
+		} else {
+			assert.Equal(t, http.StatusUnauthorized, report.StatusCode)
+		}
+	}
+}
+
+func TestClient_Diagnose_MethodInPath(t *testing.T) {
+	var path, method string
+	var rpcReq map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+
+		_ = json.Unmarshal(body, &rpcReq)
+		path, method = req.URL.Path, rpcReq["method"].(string)
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": "pong","id": "1"}`))
+	}))
+	defer server.Close()
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL:                server.URL + "/rpc/",
+			EncodeMethodInPath:     true,
+			MethodPrefix:           "gateway.",
+			PrefixQualifiedMethods: true,
+			IDType:                 IDTypeNumber,
+			ParamsEncryptor: func(method string, body []byte) ([]byte, error) {
+				return bytes.Replace(body, []byte(`"params":{}`), []byte(`"params":"encrypted"`), 1), nil
+			},
+		},
+	}
+
+	report, err := client.Diagnose(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, report.StatusCode)
+	assert.Equal(t, "gateway."+DiagnoseMethod, method)
+	assert.Equal(t, "/rpc/gateway."+DiagnoseMethod, path)
+	assert.Equal(t, "encrypted", rpcReq["params"], "the body is encrypted as the calls are")
+	assert.Equal(t, float64(1), rpcReq["id"], "the id is of the configured type")
+}
+
+func TestClient_Diagnose_Unreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config:     &Config{BaseURL: server.URL},
+	}
+
+	_, err := client.Diagnose(context.Background())
+
+	assert.Error(t, err)
+}
+
+func TestClient_VerifyCredentials(t *testing.T) {
+	var method string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		if valid, _ := VerifySignature("public", "secret", body, req.Header.Get("Authorization")); !valid {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var rpcReq map[string]interface{}
+		_ = json.Unmarshal(body, &rpcReq)
+		method, _ = rpcReq["method"].(string)
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": "pong","id": "1"}`))
+	}))
+	defer server.Close()
+
+	verify := func(secret string) error {
+		config := NewConfig("public", secret)
+		config.BaseURL = server.URL
+		return New(config).(CredentialsVerifier).VerifyCredentials(context.Background())
+	}
+
+	assert.NoError(t, verify("secret"))
+	assert.Equal(t, DiagnoseMethod, method)
+
+	err := verify("wrong")
+	assert.True(t, errors.Is(err, ErrInvalidCredentials), "unexpected error: %v", err)
+	assert.EqualError(t, err, "invalid credentials: 401 Unauthorized")
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// DiscoverMethod is the OpenRPC service discovery method called by Discover
+const DiscoverMethod = "rpc.discover"
+
+// codeMethodNotFound is the JSON-RPC error code of unknown methods
+const codeMethodNotFound = -32601
+
+// ErrDiscoveryUnsupported is returned by Discover if the server doesn't implement DiscoverMethod
+var ErrDiscoveryUnsupported = errors.New("server doesn't support " + DiscoverMethod)
+
+// OpenRPCDocument is the catalog of the methods the server implements, see https://spec.open-rpc.org
+type OpenRPCDocument struct {
+	OpenRPC string          `json:"openrpc"`
+	Info    OpenRPCInfo     `json:"info"`
+	Methods []OpenRPCMethod `json:"methods"`
+}
+
+// OpenRPCInfo describes the API
+type OpenRPCInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// OpenRPCMethod describes the method along with its params and result
+type OpenRPCMethod struct {
+	Name        string                     `json:"name"`
+	Summary     string                     `json:"summary,omitempty"`
+	Description string                     `json:"description,omitempty"`
+	Deprecated  bool                       `json:"deprecated,omitempty"`
+	Params      []OpenRPCContentDescriptor `json:"params"`
+	Result      *OpenRPCContentDescriptor  `json:"result,omitempty"`
+}
+
+// OpenRPCContentDescriptor describes the param or the result, the JSON schema is kept as is
+type OpenRPCContentDescriptor struct {
+	Name        string          `json:"name"`
+	Summary     string          `json:"summary,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Required    bool            `json:"required,omitempty"`
+	Schema      json.RawMessage `json:"schema,omitempty"`
+}
+
+// Discoverer is implemented by clients able to enumerate the methods of the API
+type Discoverer interface {
+	Discover(ctx context.Context) (OpenRPCDocument, error)
+}
+
+var _ Discoverer = apiClient{}
+
+// Discover fetches the OpenRPC document of the server. ErrDiscoveryUnsupported is returned
+// if the server doesn't know DiscoverMethod
+func (c apiClient) Discover(ctx context.Context) (OpenRPCDocument, error) {
+	var document OpenRPCDocument
+
+	var result json.RawMessage
+	err := c.CallWithContext(ctx, DiscoverMethod, []interface{}{}, &result)
+
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) && rpcErr.Code == codeMethodNotFound {
+		return document, fmt.Errorf("%w: %s", ErrDiscoveryUnsupported, rpcErr.Message)
+	}
+	if err != nil {
+		return document, err
+	}
+
+	if err = json.Unmarshal(result, &document); err != nil {
+		return document, fmt.Errorf("unable to decode OpenRPC document: %w", err)
+	}
+
+	if document.OpenRPC == "" {
+		return document, errors.New("response is not an OpenRPC document: missing openrpc member")
+	}
+
+	return document, nil
+}
@@ -0,0 +1,60 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_Discover(t *testing.T) {
+	server := testServer(`{"jsonrpc": "2.0", "id": "1", "result": {
+		"openrpc": "1.2.6",
+		"info": {"title": "Payyo API", "version": "3"},
+		"methods": [{
+			"name": "merchant.getDetails",
+			"summary": "Returns the merchant",
+			"params": [{"name": "merchant_id", "required": true, "schema": {"type": "integer"}}],
+			"result": {"name": "merchant", "schema": {"type": "object"}}
+		}]
+	}}`)
+	defer server.Close()
+	client := apiClient{HTTPClient: server.Client(), Config: &Config{BaseURL: server.URL}}
+
+	document, err := client.Discover(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, "1.2.6", document.OpenRPC)
+	assert.Equal(t, OpenRPCInfo{Title: "Payyo API", Version: "3"}, document.Info)
+	assert.Equal(t, []OpenRPCMethod{{
+		Name:    "merchant.getDetails",
+		Summary: "Returns the merchant",
+		Params: []OpenRPCContentDescriptor{
+			{Name: "merchant_id", Required: true, Schema: json.RawMessage(`{"type": "integer"}`)},
+		},
+		Result: &OpenRPCContentDescriptor{Name: "merchant", Schema: json.RawMessage(`{"type": "object"}`)},
+	}}, document.Methods)
+}
+
+func TestClient_Discover_Unsupported(t *testing.T) {
+	server := testServer(`{"jsonrpc": "2.0","error": {"code": -32601, "message": "Method not found"},"id": "1"}`)
+	defer server.Close()
+	client := apiClient{HTTPClient: server.Client(), Config: &Config{BaseURL: server.URL}}
+
+	_, err := client.Discover(context.Background())
+
+	assert.True(t, errors.Is(err, ErrDiscoveryUnsupported))
+	assert.EqualError(t, err, "server doesn't support rpc.discover: Method not found")
+}
+
+func TestClient_Discover_NotOpenRPC(t *testing.T) {
+	server := testServer(`{"jsonrpc": "2.0","result": {"methods": []},"id": "1"}`)
+	defer server.Close()
+	client := apiClient{HTTPClient: server.Client(), Config: &Config{BaseURL: server.URL}}
+
+	_, err := client.Discover(context.Background())
+
+	assert.EqualError(t, err, "response is not an OpenRPC document: missing openrpc member")
+}
@@ -0,0 +1,65 @@
+package client
+
+import "io"
+
+// EnvelopeDirection tells if the envelope has been sent or received
+type EnvelopeDirection int
+
+// Envelope directions
+const (
+	EnvelopeRequest EnvelopeDirection = iota
+	EnvelopeResponse
+)
+
+func (d EnvelopeDirection) String() string {
+	if d == EnvelopeResponse {
+		return "response"
+	}
+
+	return "request"
+}
+
+// envelopeBodyLimit is the maximum number of bytes of the response body given in Envelope
+const envelopeBodyLimit = 64 << 10
+
+// Envelope is the raw JSON-RPC request or response of the call emitted by WithEnvelopeChannel
+type Envelope struct {
+	Direction EnvelopeDirection
+	Method    string // "batch" for batches
+	ID        string // Request id, empty for batches
+	Body      []byte // Raw body, the response one is truncated to 64KB
+}
+
+// WithEnvelopeChannel emits the request and the response envelopes of every call to the channel, e.g. for live
+// debugging dashboards. The client never blocks on the channel, the envelopes are dropped while it's full
+func WithEnvelopeChannel(ch chan<- Envelope) Option {
+	return func(c *apiClient) {
+		c.envelopes = ch
+	}
+}
+
+// emitEnvelope sends the envelope to the channel unless it's full, the body is copied as it may be reused
+func (c apiClient) emitEnvelope(direction EnvelopeDirection, call *rpcCall, body []byte) {
+	envelope := Envelope{
+		Direction: direction,
+		Method:    call.info.Method,
+		ID:        call.id.value,
+		Body:      append([]byte(nil), body...),
+	}
+
+	select {
+	case c.envelopes <- envelope:
+	default:
+	}
+}
+
+// emitResponseEnvelope emits the envelope of the response body and returns the body to read it from the start
+func (c apiClient) emitResponseEnvelope(call *rpcCall, body io.ReadCloser) (io.ReadCloser, error) {
+	peeked, replay, err := peekBody(body, envelopeBodyLimit)
+	if err != nil {
+		return replay, err
+	}
+	c.emitEnvelope(EnvelopeResponse, call, peeked)
+
+	return replay, nil
+}
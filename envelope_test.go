@@ -0,0 +1,73 @@
+package client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithEnvelopeChannel(t *testing.T) {
+	server := testServer(`{"jsonrpc": "2.0","result": {},"id": "1"}`)
+	defer server.Close()
+
+	envelopes := make(chan Envelope, 2)
+	config := NewConfig("public", "secret")
+	config.BaseURL = server.URL
+	client := New(config, WithEnvelopeChannel(envelopes))
+
+	assert.NoError(t, client.Call("any.method", struct{}{}, &struct{}{}))
+
+	assert.Equal(t, Envelope{
+		Direction: EnvelopeRequest,
+		Method:    "any.method",
+		ID:        "1",
+		Body:      []byte(`{"jsonrpc":"2.0","method":"any.method","id":"1","params":{}}`),
+	}, <-envelopes)
+	assert.Equal(t, Envelope{
+		Direction: EnvelopeResponse,
+		Method:    "any.method",
+		ID:        "1",
+		Body:      []byte(`{"jsonrpc": "2.0","result": {},"id": "1"}`),
+	}, <-envelopes)
+
+	// the full channel doesn't block the calls
+	assert.NoError(t, client.Call("any.method", struct{}{}, &struct{}{}))
+	assert.NoError(t, client.Call("any.method", struct{}{}, &struct{}{}))
+	assert.Len(t, envelopes, 2)
+}
+
+func TestWithEnvelopeChannel_BodyCopied(t *testing.T) {
+	envelopes := make(chan Envelope, 1)
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) == 1 {
+			// the receiver scribbles over the body before the request is retried
+			envelope := <-envelopes
+			for i := range envelope.Body {
+				envelope.Body[i] = ' '
+			}
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {},"id": "1"}`))
+	}))
+	defer server.Close()
+
+	config := NewConfig("public", "secret")
+	config.BaseURL = server.URL
+	config.RetryMax = 1
+	config.RetryWaitMin = time.Millisecond
+	config.RetryWaitMax = time.Millisecond
+	client := New(config, WithEnvelopeChannel(envelopes))
+
+	assert.NoError(t, client.Call("any.method", struct{}{}, &struct{}{}))
+	if assert.Len(t, bodies, 2) {
+		assert.Equal(t, bodies[0], bodies[1], "the retried body is intact")
+	}
+}
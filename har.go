@@ -0,0 +1,155 @@
+package client
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// harBodyLimit is the maximum number of bytes of the response body kept in HAR entry
+const harBodyLimit = 1 << 20
+
+// WithHARWriter writes HAR (HTTP Archive) entry of every attempt to the writer as soon as it's completed,
+// one JSON entry per line, and flushes the writer if it has Flush method. Nothing is kept in memory, so
+// the lines are the entries of HAR log to be wrapped into a document by the reader. The Authorization
+// header is redacted
+func WithHARWriter(w io.Writer) Option {
+	return func(c *apiClient) {
+		c.har = &harWriter{writer: w}
+	}
+}
+
+type harWriter struct {
+	mu     sync.Mutex
+	writer io.Writer
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type harRequest struct {
+	Method      string       `json:"method"`
+	URL         string       `json:"url"`
+	HTTPVersion string       `json:"httpVersion"`
+	Headers     []harNVP     `json:"headers"`
+	PostData    *harPostData `json:"postData,omitempty"`
+	HeadersSize int          `json:"headersSize"`
+	BodySize    int          `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int        `json:"status"`
+	StatusText  string     `json:"statusText"`
+	HTTPVersion string     `json:"httpVersion"`
+	Headers     []harNVP   `json:"headers"`
+	Content     harContent `json:"content"`
+	HeadersSize int        `json:"headersSize"`
+	BodySize    int        `json:"bodySize"`
+}
+
+type harNVP struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+// write records the attempt. The response body is replaced by the one replaying the read bytes
+func (h *harWriter) write(req *http.Request, resp *http.Response, started time.Time, err error) error {
+	entry := harEntry{
+		StartedDateTime: started.Format(time.RFC3339Nano),
+		Time:            float64(time.Since(started)) / float64(time.Millisecond),
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         req.URL.String(),
+			HTTPVersion: req.Proto,
+			Headers:     harHeaders(req.Header),
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Response: harResponse{
+			Headers:     []harNVP{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+	}
+
+	if capturableBody(req) {
+		if body, bodyErr := req.GetBody(); bodyErr == nil {
+			data, _ := ioutil.ReadAll(body)
+			entry.Request.BodySize = len(data)
+			entry.Request.PostData = &harPostData{MimeType: req.Header.Get("Content-Type"), Text: string(data)}
+		}
+	}
+
+	if resp != nil {
+		peeked, replay, peekErr := peekBody(resp.Body, harBodyLimit)
+		resp.Body = replay
+		if peekErr != nil && err == nil {
+			err = peekErr
+		}
+
+		entry.Response.Status = resp.StatusCode
+		entry.Response.StatusText = http.StatusText(resp.StatusCode)
+		entry.Response.HTTPVersion = resp.Proto
+		entry.Response.Headers = harHeaders(resp.Header)
+		entry.Response.Content = harContent{
+			Size:     len(peeked),
+			MimeType: resp.Header.Get("Content-Type"),
+			Text:     string(peeked),
+		}
+	}
+
+	if err != nil {
+		entry.Comment = err.Error()
+	}
+
+	line, marshalErr := json.Marshal(entry)
+	if marshalErr != nil {
+		return marshalErr
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, err = h.writer.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	if f, ok := h.writer.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+
+	return nil
+}
+
+func harHeaders(header http.Header) []harNVP {
+	headers := make([]harNVP, 0, len(header))
+	for name, values := range header {
+		for _, value := range values {
+			if http.CanonicalHeaderKey(name) == "Authorization" {
+				value = "REDACTED"
+			}
+			headers = append(headers, harNVP{Name: name, Value: value})
+		}
+	}
+
+	return headers
+}
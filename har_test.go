@@ -0,0 +1,102 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// flushingBuffer counts the flushes to check every entry is flushed once written
+type flushingBuffer struct {
+	bytes.Buffer
+	flushes int
+}
+
+func (b *flushingBuffer) Flush() error {
+	b.flushes++
+	return nil
+}
+
+func TestWithHARWriter(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requests++
+		if requests == 1 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {"key": "Value"},"id": "1"}`))
+	}))
+	defer server.Close()
+
+	var har flushingBuffer
+	cfg := NewConfig("key", "secret")
+	cfg.BaseURL = server.URL
+	cfg.RetryMax = 1
+	cfg.RetryWaitMin = time.Millisecond
+	cfg.RetryWaitMax = time.Millisecond
+	client := New(cfg, WithHARWriter(&har)).(*apiClient)
+	client.HTTPClient = server.Client()
+
+	result := &struct {
+		Key string `json:"key"`
+	}{}
+	err := client.Call("any.method", struct{}{}, result)
+	assert.NoError(t, err)
+	assert.Equal(t, "Value", result.Key)
+	assert.Equal(t, 2, har.flushes, "every attempt is flushed")
+
+	var entries []harEntry
+	scanner := bufio.NewScanner(bytes.NewReader(har.Bytes()))
+	for scanner.Scan() {
+		var entry harEntry
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	if !assert.Len(t, entries, 2, "every attempt is written") {
+		return
+	}
+
+	failed, entry := entries[0], entries[1]
+	assert.Equal(t, http.StatusServiceUnavailable, failed.Response.Status)
+	assert.Equal(t, http.MethodPost, entry.Request.Method)
+	assert.Equal(t, server.URL, entry.Request.URL)
+	assert.Equal(t, `{"jsonrpc":"2.0","method":"any.method","id":"1","params":{}}`, entry.Request.PostData.Text)
+	assert.Equal(t, http.StatusOK, entry.Response.Status)
+	assert.Equal(t, `{"jsonrpc": "2.0","result": {"key": "Value"},"id": "1"}`, entry.Response.Content.Text)
+	assert.Contains(t, entry.Request.Headers, harNVP{Name: "Authorization", Value: "REDACTED"})
+	assert.NotContains(t, har.String(), "Basic ")
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk is full")
+}
+
+func TestWithHARWriter_WriteError(t *testing.T) {
+	server := testServer(`{"jsonrpc": "2.0","result": {"key": "Value"},"id": "1"}`)
+	defer server.Close()
+
+	var errs []string
+	cfg := NewConfig("key", "secret")
+	cfg.BaseURL = server.URL
+	cfg.Logger = LoggerFunc(func(level LogLevel, format string, args ...interface{}) {
+		if level == ErrorLevel {
+			errs = append(errs, fmt.Sprintf(format, args...))
+		}
+	})
+	client := New(cfg, WithHARWriter(failingWriter{}))
+
+	var result map[string]string
+	assert.NoError(t, client.Call("any.method", struct{}{}, &result), "the call doesn't fail")
+	assert.Equal(t, []string{"unable to write HAR entry: disk is full"}, errs)
+}
@@ -0,0 +1,119 @@
+package client
+
+import (
+	"bytes"
+	crand "crypto/rand"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// IDGenerator generates ids of requests which are sent without one
+type IDGenerator func() (string, error)
+
+// UUIDIDGenerator generates random (version 4) UUIDs, so requests can be correlated across systems
+func UUIDIDGenerator() (string, error) {
+	var uuid [16]byte
+	if _, err := crand.Read(uuid[:]); err != nil {
+		return "", fmt.Errorf("unable to generate request id: %w", err)
+	}
+
+	uuid[6] = uuid[6]&0x0f | 0x40 // version 4
+	uuid[8] = uuid[8]&0x3f | 0x80 // RFC 4122 variant
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16]), nil
+}
+
+// requestID returns the given id or generates one if the generator is configured
+func (c apiClient) requestID(id string) (string, error) {
+	if id != "" || c.Config.IDGenerator == nil {
+		return id, nil
+	}
+
+	return c.Config.IDGenerator()
+}
+
+// IDType is the JSON type of the request id the server expects
+type IDType int
+
+const (
+	// IDTypeString sends the id as a string, e.g. "1"
+	IDTypeString IDType = iota
+	// IDTypeNumber sends the id as a number, e.g. 1. The ids have to be integers then
+	IDTypeNumber
+)
+
+// rpcID is the request id which keeps its JSON type, so the response id matches only the one of the same type
+type rpcID struct {
+	value  string
+	number bool
+}
+
+// MarshalJSON encodes the id as a string or a bare number
+func (id rpcID) MarshalJSON() ([]byte, error) {
+	if id.number {
+		return []byte(id.value), nil
+	}
+
+	return json.Marshal(id.value)
+}
+
+// UnmarshalJSON decodes the id given as a string or a number, null is decoded as the empty id
+func (id *rpcID) UnmarshalJSON(data []byte) error {
+	switch {
+	case bytes.Equal(data, []byte("null")):
+		*id = rpcID{}
+		return nil
+	case len(data) > 0 && data[0] == '"':
+		id.number = false
+		return json.Unmarshal(data, &id.value)
+	}
+
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return fmt.Errorf("id must be a string or a number: %w", err)
+	}
+	*id = rpcID{value: number.String(), number: true}
+
+	return nil
+}
+
+// String returns the id as it's encoded
+func (id rpcID) String() string {
+	if id.number {
+		return id.value
+	}
+
+	return strconv.Quote(id.value)
+}
+
+// matches compares the ids of the same type, string ids are compared case-insensitively,
+// so the server is free to echo UUIDs in upper case
+func (id rpcID) matches(other rpcID) bool {
+	return id.key() == other.key()
+}
+
+// key is equal for the ids which match, e.g. to look the id up in a map
+func (id rpcID) key() string {
+	if id.number {
+		return "n:" + id.value
+	}
+
+	return "s:" + strings.ToLower(id.value)
+}
+
+// typedID returns the request id of the configured type
+func (c apiClient) typedID(id string) (rpcID, error) {
+	if c.Config.IDType != IDTypeNumber {
+		return rpcID{value: id}, nil
+	}
+
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return rpcID{}, fmt.Errorf("request id %q is not a number", id)
+	}
+
+	// the id is re-formatted, since e.g. "+1" and "007" are not valid JSON numbers
+	return rpcID{value: strconv.FormatInt(n, 10), number: true}, nil
+}
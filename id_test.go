@@ -0,0 +1,100 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var uuidV4 = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestUUIDIDGenerator(t *testing.T) {
+	first, err := UUIDIDGenerator()
+	assert.NoError(t, err)
+	assert.Regexp(t, uuidV4, first)
+
+	second, err := UUIDIDGenerator()
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, second)
+}
+
+func TestClient_Call_UUIDRequestID(t *testing.T) {
+	var sentID, reportedID string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		var rpcReq rpcRequest
+		assert.NoError(t, json.Unmarshal(body, &rpcReq))
+		sentID = rpcReq.ID.value
+
+		// the server is free to echo the id in upper case
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {},"id": "` + strings.ToUpper(sentID) + `"}`))
+	}))
+	defer server.Close()
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL:     server.URL,
+			IDGenerator: UUIDIDGenerator,
+			OnComplete: func(info CallInfo) {
+				reportedID = info.ID
+			},
+		},
+	}
+
+	err := client.Call("any.method", struct{}{}, &struct{}{})
+
+	assert.NoError(t, err)
+	assert.Regexp(t, uuidV4, sentID)
+	assert.Equal(t, sentID, reportedID)
+}
+
+func TestClient_Call_IDType(t *testing.T) {
+	var sentID string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var rpcReq map[string]json.RawMessage
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(&rpcReq))
+		sentID = string(rpcReq["id"])
+
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {},"id": ` + sentID + `}`))
+	}))
+	defer server.Close()
+
+	call := func(idType IDType) error {
+		client := apiClient{HTTPClient: server.Client(), Config: &Config{BaseURL: server.URL, IDType: idType}}
+		return client.Call("any.method", struct{}{}, &struct{}{})
+	}
+
+	assert.NoError(t, call(IDTypeString))
+	assert.Equal(t, `"1"`, sentID)
+
+	assert.NoError(t, call(IDTypeNumber))
+	assert.Equal(t, `1`, sentID)
+
+	for id, formatted := range map[string]string{"+1": "1", "007": "7", "-3": "-3"} {
+		client := apiClient{HTTPClient: server.Client(), Config: &Config{BaseURL: server.URL, IDType: IDTypeNumber}}
+		err := client.CallRequest(context.Background(), Request{Method: "any.method", ID: id}, &struct{}{})
+
+		assert.NoError(t, err, id)
+		assert.Equal(t, formatted, sentID, "the id %q is sent as a valid JSON number", id)
+	}
+}
+
+func TestClient_Call_IDTypeMismatch(t *testing.T) {
+	server := testServer(`{"jsonrpc": "2.0","result": {},"id": "1"}`)
+	defer server.Close()
+	client := apiClient{HTTPClient: server.Client(), Config: &Config{BaseURL: server.URL, IDType: IDTypeNumber}}
+
+	err := client.Call("any.method", struct{}{}, &struct{}{})
+	assert.EqualError(t, err, `response id "1" doesn't match request id 1`)
+
+	err = client.CallRequest(context.Background(), Request{Method: "any.method", ID: "abc"}, &struct{}{})
+	assert.EqualError(t, err, `request id "abc" is not a number`)
+}
@@ -1,9 +1,12 @@
 package client
 
 import (
+	"context"
 	"io/ioutil"
 	"log"
 	"os"
+	"sort"
+	"strings"
 )
 
 // LogLevel specifies the logger log level
@@ -72,3 +75,62 @@ type LoggerFunc func(level LogLevel, format string, args ...interface{})
 func (f LoggerFunc) Logf(level LogLevel, format string, args ...interface{}) {
 	f(level, format, args...)
 }
+
+type correlationIDKey struct{}
+
+// WithCorrelationID returns the context carrying the id to prefix log messages of the call with
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// CorrelationIDFromContext returns the correlation id set by WithCorrelationID
+func CorrelationIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(correlationIDKey{}).(string)
+	return id, ok && id != ""
+}
+
+type httpTraceKey struct{}
+
+// WithHTTPTrace returns the context enabling the connection events of the call, e.g. whether the pooled
+// connection is reused, to be logged at DebugLevel. It's off by default since tracing has overhead
+func WithHTTPTrace(ctx context.Context) context.Context {
+	return context.WithValue(ctx, httpTraceKey{}, true)
+}
+
+func httpTraceEnabled(ctx context.Context) bool {
+	enabled, _ := ctx.Value(httpTraceKey{}).(bool)
+	return enabled
+}
+
+type metadataKey struct{}
+
+// WithMetadata returns the context carrying the business context of the call, e.g. order_id, to append
+// to log messages and to report in CallInfo. The metadata is never sent, it's merged with the one of the parent context
+func WithMetadata(ctx context.Context, metadata map[string]string) context.Context {
+	merged := make(map[string]string, len(metadata))
+	for key, value := range MetadataFromContext(ctx) {
+		merged[key] = value
+	}
+	for key, value := range metadata {
+		merged[key] = value
+	}
+
+	return context.WithValue(ctx, metadataKey{}, merged)
+}
+
+// MetadataFromContext returns the metadata set by WithMetadata, nil if there is none
+func MetadataFromContext(ctx context.Context) map[string]string {
+	metadata, _ := ctx.Value(metadataKey{}).(map[string]string)
+	return metadata
+}
+
+// formatMetadata returns the metadata as key=value pairs sorted by key
+func formatMetadata(metadata map[string]string) string {
+	pairs := make([]string, 0, len(metadata))
+	for key, value := range metadata {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, " ")
+}
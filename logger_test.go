@@ -2,9 +2,16 @@ package client
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -47,3 +54,112 @@ func TestLevel_String(t *testing.T) {
 	assert.Equal(t, "info", InfoLevel.String())
 	assert.Equal(t, "debug", DebugLevel.String())
 }
+
+func TestClient_Call_CorrelationID(t *testing.T) {
+	server := testServer(`{"jsonrpc": "2.0","result": {},"id": "1"}`)
+
+	var lines []string
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL: server.URL,
+			Logger: LoggerFunc(func(level LogLevel, format string, args ...interface{}) {
+				lines = append(lines, fmt.Sprintf(format, args...))
+			}),
+		},
+	}
+
+	ctx := WithCorrelationID(context.Background(), "corr-42")
+	err := client.CallWithContext(ctx, "any.method", struct{}{}, &struct{}{})
+
+	assert.NoError(t, err)
+	assert.NotEmpty(t, lines)
+	for _, line := range lines {
+		assert.True(t, strings.HasPrefix(line, "[corr-42] "), line)
+	}
+}
+
+func TestCorrelationIDFromContext(t *testing.T) {
+	_, ok := CorrelationIDFromContext(context.Background())
+	assert.False(t, ok)
+
+	id, ok := CorrelationIDFromContext(WithCorrelationID(context.Background(), "corr-42"))
+	assert.True(t, ok)
+	assert.Equal(t, "corr-42", id)
+}
+
+func TestClient_Call_Metadata(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		raw, _ := ioutil.ReadAll(req.Body)
+		body = string(raw)
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {},"id": "1"}`))
+	}))
+	defer server.Close()
+
+	var lines []string
+	var observed CallInfo
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL: server.URL,
+			Logger: LoggerFunc(func(level LogLevel, format string, args ...interface{}) {
+				lines = append(lines, fmt.Sprintf(format, args...))
+			}),
+			OnComplete: func(info CallInfo) { observed = info },
+		},
+	}
+
+	ctx := WithMetadata(context.Background(), map[string]string{"order_id": "42"})
+	ctx = WithMetadata(ctx, map[string]string{"shop": "main"})
+	err := client.CallWithContext(ctx, "any.method", struct{}{}, &struct{}{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"order_id": "42", "shop": "main"}, observed.Metadata)
+	assert.NotEmpty(t, lines)
+	for _, line := range lines {
+		assert.True(t, strings.HasSuffix(line, " {order_id=42 shop=main}"), line)
+	}
+	assert.NotContains(t, body, "order_id", "the metadata is not sent")
+}
+
+func TestClient_Call_HTTPTrace(t *testing.T) {
+	server := testServer(`{"jsonrpc": "2.0","result": {},"id": "1"}`)
+	defer server.Close()
+
+	var mu sync.Mutex
+	var lines []string
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL: server.URL,
+			Logger: LoggerFunc(func(level LogLevel, format string, args ...interface{}) {
+				mu.Lock()
+				defer mu.Unlock()
+				if strings.Contains(format, "connection") {
+					lines = append(lines, fmt.Sprintf(format, args...))
+				}
+			}),
+		},
+	}
+
+	assert.NoError(t, client.Call("any.method", struct{}{}, &struct{}{}))
+	assert.Empty(t, lines, "tracing is off by default")
+
+	ctx := WithHTTPTrace(context.Background())
+	assert.NoError(t, client.CallWithContext(ctx, "any.method", struct{}{}, &struct{}{}))
+	assert.NoError(t, client.CallWithContext(ctx, "any.method", struct{}{}, &struct{}{}))
+
+	mu.Lock()
+	defer mu.Unlock()
+	var gotConn []string
+	for _, line := range lines {
+		if strings.Contains(line, "got connection") {
+			gotConn = append(gotConn, line)
+		}
+	}
+	if assert.Len(t, gotConn, 2) {
+		assert.Contains(t, gotConn[0], "reused: true, was idle: true")
+		assert.Contains(t, gotConn[1], "reused: true, was idle: true")
+	}
+}
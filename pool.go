@@ -0,0 +1,113 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+)
+
+// PoolStats is the snapshot of the connection pool of the transport built from Config
+type PoolStats struct {
+	Open   int // Connections dialed and not closed yet
+	Active int // Connections serving the requests, i.e. until the response body is closed
+	Idle   int // Open connections waiting in the pool to be reused
+}
+
+// PoolStatsReporter is implemented by clients reporting the state of their connection pool
+type PoolStatsReporter interface {
+	PoolStats() PoolStats
+}
+
+var _ PoolStatsReporter = apiClient{}
+
+// PoolStats returns the state of the connection pool, e.g. for capacity planning. It's tracked only if
+// Config.TrackConnectionPool is set, the connections of the transports given by options are not counted
+// as open. HTTP/2 requests multiplexed over a single connection are counted as active connections each
+func (c apiClient) PoolStats() PoolStats {
+	if c.pool == nil {
+		return PoolStats{}
+	}
+
+	return c.pool.snapshot()
+}
+
+type dialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// poolStats counts the connections of the transport
+type poolStats struct {
+	mu     sync.Mutex
+	open   int
+	active int
+}
+
+func (p *poolStats) snapshot() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := PoolStats{Open: p.open, Active: p.active}
+	if idle := p.open - p.active; idle > 0 {
+		stats.Idle = idle
+	}
+
+	return stats
+}
+
+// dialContext wraps the dial to count the connections until they are closed
+func (p *poolStats) dialContext(dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dial(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+
+		p.mu.Lock()
+		p.open++
+		p.mu.Unlock()
+
+		return &pooledConn{Conn: conn, pool: p}, nil
+	}
+}
+
+// acquire counts the connection taken by the request, the returned function releases it and may be called many times
+func (p *poolStats) acquire() func() {
+	p.mu.Lock()
+	p.active++
+	p.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			p.mu.Lock()
+			p.active--
+			p.mu.Unlock()
+		})
+	}
+}
+
+type pooledConn struct {
+	net.Conn
+	pool *poolStats
+	once sync.Once
+}
+
+func (c *pooledConn) Close() error {
+	c.once.Do(func() {
+		c.pool.mu.Lock()
+		c.pool.open--
+		c.pool.mu.Unlock()
+	})
+
+	return c.Conn.Close()
+}
+
+// releasingBody releases the connection once the response body is closed
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	b.release()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_PoolStats(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		<-release
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {},"id": "1"}`))
+	}))
+	defer server.Close()
+
+	config := NewConfig("public", "secret")
+	config.BaseURL = server.URL
+	config.TrackConnectionPool = true
+	client := New(config).(PoolStatsReporter)
+	assert.Equal(t, PoolStats{}, client.PoolStats())
+
+	const calls = 4
+	var wg sync.WaitGroup
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, client.(Client).Call("any.method", struct{}{}, &struct{}{}))
+		}()
+	}
+
+	assert.Eventually(t, func() bool {
+		return client.PoolStats() == PoolStats{Open: calls, Active: calls}
+	}, time.Second, time.Millisecond, "stats: %+v", client.PoolStats())
+
+	close(release)
+	wg.Wait()
+
+	// the transport keeps as many idle connections as MaxIdleConnsPerHost allows and closes the rest
+	stats := client.PoolStats()
+	assert.Equal(t, 0, stats.Active)
+	assert.Greater(t, stats.Idle, 0)
+	assert.Equal(t, stats.Open, stats.Idle)
+}
@@ -0,0 +1,160 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// Fixture is the recorded JSON-RPC request and the response to it, e.g. the bodies captured by WithBodyTee
+type Fixture struct {
+	Request  json.RawMessage `json:"request"`
+	Response json.RawMessage `json:"response"`
+}
+
+// WriteFixture saves the recorded bodies to the file in the format LoadReplayTransport reads
+func WriteFixture(path string, request, response []byte) error {
+	data, err := json.MarshalIndent(Fixture{Request: request, Response: response}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode fixture: %w", err)
+	}
+
+	return ioutil.WriteFile(path, data, 0o600)
+}
+
+// ReplayTransport serves the recorded responses matching the requests by method and params, so the client
+// works offline, e.g. in tests. The id of the response is replaced by the one of the request. Batches
+// are not supported
+type ReplayTransport struct {
+	responses map[string]json.RawMessage
+}
+
+var _ http.RoundTripper = &ReplayTransport{}
+
+// NewReplayTransport creates the transport serving the fixtures, the later ones win for the same request
+func NewReplayTransport(fixtures ...Fixture) (*ReplayTransport, error) {
+	t := &ReplayTransport{responses: make(map[string]json.RawMessage, len(fixtures))}
+	for i, fixture := range fixtures {
+		key, _, err := fixtureKey(fixture.Request)
+		if err != nil {
+			return nil, fmt.Errorf("invalid request of fixture %d: %w", i, err)
+		}
+		t.responses[key] = fixture.Response
+	}
+
+	return t, nil
+}
+
+// LoadReplayTransport creates the transport serving the fixtures of all *.json files of the directory
+func LoadReplayTransport(dir string) (*ReplayTransport, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	fixtures := make([]Fixture, 0, len(paths))
+	for _, path := range paths {
+		var data []byte
+		if data, err = ioutil.ReadFile(path); err != nil {
+			return nil, err
+		}
+
+		var fixture Fixture
+		if err = json.Unmarshal(data, &fixture); err != nil {
+			return nil, fmt.Errorf("invalid fixture %s: %w", path, err)
+		}
+		fixtures = append(fixtures, fixture)
+	}
+
+	return NewReplayTransport(fixtures...)
+}
+
+// RoundTrip serves the recorded response to the request. The request no fixture has been recorded for
+// is answered by 501 Not Implemented, so the client fails with StatusError and doesn't retry it
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		_ = req.Body.Close()
+	}
+
+	key, id, err := fixtureKey(body)
+	if err != nil {
+		return nil, err
+	}
+
+	recorded, ok := t.responses[key]
+	if !ok {
+		message := []byte("no fixture for " + key)
+		return replayResponse(req, http.StatusNotImplemented, "501 No fixture for "+key, "text/plain; charset=utf-8", message), nil
+	}
+
+	response, err := withResponseID(recorded, id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fixture response of %s: %w", key, err)
+	}
+
+	return replayResponse(req, http.StatusOK, "200 OK", "application/json; charset=utf-8", response), nil
+}
+
+// replayResponse builds the response served by ReplayTransport
+func replayResponse(req *http.Request, statusCode int, status, contentType string, body []byte) *http.Response {
+	return &http.Response{
+		Status:        status,
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {contentType}},
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// fixtureKey returns the method along with the canonical params the request is matched by, and its id
+func fixtureKey(body []byte) (key string, id json.RawMessage, err error) {
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		return "", nil, errors.New("batches are not supported")
+	}
+
+	var request struct {
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+		ID     json.RawMessage `json:"id"`
+	}
+	if err = json.Unmarshal(body, &request); err != nil {
+		return "", nil, err
+	}
+
+	params := []byte("null")
+	if len(request.Params) > 0 {
+		if params, err = canonicalJSON(request.Params); err != nil {
+			return "", nil, err
+		}
+	}
+
+	return strings.TrimSpace(request.Method) + " " + string(params), request.ID, nil
+}
+
+// withResponseID replaces the recorded id of the response by the one of the request
+func withResponseID(response, id json.RawMessage) ([]byte, error) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(response, &members); err != nil {
+		return nil, err
+	}
+
+	if len(id) > 0 {
+		members["id"] = id
+	}
+
+	return json.Marshal(members)
+}
@@ -0,0 +1,52 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type merchantDetails struct {
+	MerchantID int    `json:"merchant_id"`
+	Name       string `json:"name"`
+}
+
+func TestReplayTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {"merchant_id": 42, "name": "Shop"},"id": "1"}`))
+	}))
+
+	var requests, responses bytes.Buffer
+	config := NewConfig("public", "secret")
+	config.BaseURL = server.URL
+	recorder := New(config, WithBodyTee(&requests, &responses))
+
+	var recorded merchantDetails
+	assert.NoError(t, recorder.Call("merchant.GetDetails", map[string]int{"merchant_id": 42}, &recorded))
+	server.Close()
+
+	dir := t.TempDir()
+	assert.NoError(t, WriteFixture(filepath.Join(dir, "merchant.json"), requests.Bytes(), responses.Bytes()))
+
+	transport, err := LoadReplayTransport(dir)
+	assert.NoError(t, err)
+
+	// the replayed call is sent offline with another id
+	config.IDGenerator = UUIDIDGenerator
+	replayer := New(config, WithTransport(transport))
+
+	var replayed merchantDetails
+	assert.NoError(t, replayer.Call("merchant.GetDetails", map[string]int{"merchant_id": 42}, &replayed))
+	assert.Equal(t, recorded, replayed)
+
+	err = replayer.Call("merchant.GetDetails", map[string]int{"merchant_id": 7}, &replayed)
+	var statusErr *StatusError
+	assert.True(t, errors.As(err, &statusErr), "unexpected error: %v", err)
+	assert.Equal(t, http.StatusNotImplemented, statusErr.StatusCode)
+	assert.Contains(t, err.Error(), `merchant.GetDetails {"merchant_id":7}`)
+}
@@ -0,0 +1,189 @@
+package client
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RequestRetryer decides whether a request has to be retried and how long to wait before the next attempt
+type RequestRetryer interface {
+	ShouldRetry(ctx context.Context, resp *http.Response, attemptNum int, err error) (bool, error)
+	Backoff(attemptNum int, resp *http.Response) time.Duration
+}
+
+// NewDefaultRetryer returns the retryer which retries recoverable errors up to retryMax attempts
+// waiting in between as the backoff function suggests
+func NewDefaultRetryer(retryMax int, waitMin, waitMax time.Duration, backoff Backoff) RequestRetryer {
+	if backoff == nil {
+		backoff = defaultRequestBackoff
+	}
+
+	return &defaultRetryer{
+		retryMax: retryMax,
+		waitMin:  waitMin,
+		waitMax:  waitMax,
+		backoff:  backoff,
+	}
+}
+
+type defaultRetryer struct {
+	retryMax int
+	waitMin  time.Duration
+	waitMax  time.Duration
+	backoff  Backoff
+}
+
+// ShouldRetry applies the default retry policy
+func (r *defaultRetryer) ShouldRetry(ctx context.Context, resp *http.Response, attemptNum int, err error) (bool, error) {
+	return checkRetry(ctx, resp, r.retryMax, attemptNum, err)
+}
+
+// Backoff returns the time to wait before the next attempt
+func (r *defaultRetryer) Backoff(attemptNum int, resp *http.Response) time.Duration {
+	return r.backoff(r.waitMin, r.waitMax, attemptNum, resp)
+}
+
+// NewConstantRequestRetryer returns the retryer which retries recoverable errors up to retryMax times
+// waiting the delay in between, unless the server asks to wait longer by Retry-After header of 429 response
+func NewConstantRequestRetryer(retryMax int, delay time.Duration) RequestRetryer {
+	return NewDefaultRetryer(retryMax, delay, delay, ConstantBackoff)
+}
+
+// NewScheduleRetryer returns the retryer which waits the given delays before the retries in turn,
+// the last delay is repeated if there are more attempts. The request is attempted up to len(delays)+1 times
+func NewScheduleRetryer(delays []time.Duration) RequestRetryer {
+	return &scheduleRetryer{
+		delays: append([]time.Duration(nil), delays...),
+	}
+}
+
+type scheduleRetryer struct {
+	delays []time.Duration
+}
+
+// ShouldRetry applies the default retry policy until the schedule is over
+func (r *scheduleRetryer) ShouldRetry(ctx context.Context, resp *http.Response, attemptNum int, err error) (bool, error) {
+	return checkRetry(ctx, resp, len(r.delays), attemptNum, err)
+}
+
+// Backoff returns the scheduled delay of the attempt
+func (r *scheduleRetryer) Backoff(attemptNum int, resp *http.Response) time.Duration {
+	if len(r.delays) == 0 {
+		return 0
+	}
+
+	if attemptNum < 1 {
+		attemptNum = 1
+	}
+	if attemptNum > len(r.delays) {
+		attemptNum = len(r.delays)
+	}
+
+	return r.delays[attemptNum-1]
+}
+
+// PreviewBackoff returns the delays the retryer waits before the attempts 1..attempts following the given response,
+// e.g. to test or chart the schedule. Nothing is slept. Randomized backoffs, e.g. the jittered ones, return
+// different values on every call, and the stateful retryers may be affected as if the attempts were made
+func PreviewBackoff(retryer RequestRetryer, attempts int, resp *http.Response) []time.Duration {
+	delays := make([]time.Duration, 0, attempts)
+	for attempt := 1; attempt <= attempts; attempt++ {
+		delays = append(delays, retryer.Backoff(attempt, resp))
+	}
+
+	return delays
+}
+
+// NewLoggingRetryer wraps the retryer to log every decision it makes
+func NewLoggingRetryer(inner RequestRetryer, logger Logger) RequestRetryer {
+	return &loggingRetryer{
+		inner:  inner,
+		logger: logger,
+	}
+}
+
+type loggingRetryer struct {
+	inner  RequestRetryer
+	logger Logger
+}
+
+// ShouldRetry delegates to the inner retryer and logs the decision
+func (r *loggingRetryer) ShouldRetry(ctx context.Context, resp *http.Response, attemptNum int, err error) (bool, error) {
+	shouldRetry, checkErr := r.inner.ShouldRetry(ctx, resp, attemptNum, err)
+
+	status := "none"
+	if resp != nil {
+		status = resp.Status
+	}
+	r.logger.Logf(DebugLevel, "attempt %d: status: %s, error: %v, retry: %t", attemptNum, status, checkErr, shouldRetry)
+
+	return shouldRetry, checkErr
+}
+
+// Backoff delegates to the inner retryer and logs the delay
+func (r *loggingRetryer) Backoff(attemptNum int, resp *http.Response) time.Duration {
+	wait := r.inner.Backoff(attemptNum, resp)
+	r.logger.Logf(DebugLevel, "attempt %d: backoff %s", attemptNum, wait)
+
+	return wait
+}
+
+// NewAIMDRetryer limits retries granted by the inner retryer with the token bucket shared by all calls.
+// Every retry takes a token, every 2xx response adds the increase (additive increase) and every 429 or 503
+// response multiplies the tokens by the decrease factor (multiplicative decrease), so retries cease
+// during outages instead of piling up on the struggling server. The bucket starts full
+func NewAIMDRetryer(inner RequestRetryer, capacity, increase, decrease float64) RequestRetryer {
+	return &aimdRetryer{
+		inner:    inner,
+		capacity: capacity,
+		increase: increase,
+		decrease: decrease,
+		tokens:   capacity,
+	}
+}
+
+type aimdRetryer struct {
+	inner    RequestRetryer
+	capacity float64
+	increase float64
+	decrease float64
+
+	mu     sync.Mutex
+	tokens float64
+}
+
+// ShouldRetry updates the bucket from the response and grants the retry if there is a token left
+func (r *aimdRetryer) ShouldRetry(ctx context.Context, resp *http.Response, attemptNum int, err error) (bool, error) {
+	shouldRetry, checkErr := r.inner.ShouldRetry(ctx, resp, attemptNum, err)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if resp != nil {
+		switch {
+		case resp.StatusCode >= 200 && resp.StatusCode < 300:
+			r.tokens = math.Min(r.capacity, r.tokens+r.increase)
+		case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+			r.tokens *= r.decrease
+		}
+	}
+
+	if !shouldRetry {
+		return false, checkErr
+	}
+
+	if r.tokens < 1 {
+		return false, checkErr
+	}
+	r.tokens--
+
+	return true, checkErr
+}
+
+// Backoff delegates to the inner retryer
+func (r *aimdRetryer) Backoff(attemptNum int, resp *http.Response) time.Duration {
+	return r.inner.Backoff(attemptNum, resp)
+}
@@ -0,0 +1,185 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoggingRetryer(t *testing.T) {
+	var reqCounter int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		reqCounter++
+		if reqCounter <= 1 {
+			rw.WriteHeader(500)
+			return
+		}
+
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {},"id": "1"}`))
+	}))
+
+	var lines []string
+	logger := LoggerFunc(func(level LogLevel, format string, args ...interface{}) {
+		assert.Equal(t, DebugLevel, level)
+		lines = append(lines, fmt.Sprintf(format, args...))
+	})
+	noWait := func(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
+		return 0
+	}
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL: server.URL,
+			Retryer: NewLoggingRetryer(NewDefaultRetryer(2, 0, 0, noWait), logger),
+		},
+	}
+
+	err := client.Call("any.method", struct{}{}, &struct{}{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"attempt 1: status: 500 Internal Server Error, error: 500 Internal Server Error, retry: true",
+		"attempt 1: backoff 0s",
+		"attempt 2: status: 200 OK, error: <nil>, retry: false",
+	}, lines)
+}
+
+// doublingRetryer doubles the delay on every retry, the waits are shared by the retryers of all calls
+type doublingRetryer struct {
+	delay time.Duration
+	waits *[]time.Duration
+}
+
+func (r *doublingRetryer) ShouldRetry(ctx context.Context, resp *http.Response, attemptNum int, err error) (bool, error) {
+	return checkRetry(ctx, resp, 5, attemptNum, err)
+}
+
+func (r *doublingRetryer) Backoff(attemptNum int, resp *http.Response) time.Duration {
+	r.delay *= 2
+	*r.waits = append(*r.waits, r.delay)
+	return time.Millisecond
+}
+
+func TestClient_Call_RetryerPerCall(t *testing.T) {
+	var failures int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if failures > 0 {
+			failures--
+			rw.WriteHeader(500)
+			return
+		}
+
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {},"id": "1"}`))
+	}))
+	defer server.Close()
+
+	var waits []time.Duration
+	sharedRetryer := &doublingRetryer{delay: time.Millisecond, waits: &waits}
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL: server.URL,
+			Retryer: sharedRetryer,
+			NewRetryer: func() RequestRetryer {
+				return NewLoggingRetryer(&doublingRetryer{delay: time.Millisecond, waits: &waits}, NewNullLogger())
+			},
+		},
+	}
+
+	failures = 3
+	assert.NoError(t, client.Call("slow.method", struct{}{}, &struct{}{}))
+	failures = 1
+	assert.NoError(t, client.Call("any.method", struct{}{}, &struct{}{}))
+
+	assert.Equal(t, []time.Duration{2 * time.Millisecond, 4 * time.Millisecond, 8 * time.Millisecond, 2 * time.Millisecond}, waits)
+	assert.Equal(t, time.Millisecond, sharedRetryer.delay, "NewRetryer takes precedence over Retryer")
+}
+
+func TestAIMDRetryer(t *testing.T) {
+	retryer := NewAIMDRetryer(NewDefaultRetryer(100, 0, 0, nil), 5, 1, 0.5)
+	respond := func(status int, times int) (granted int) {
+		for i := 0; i < times; i++ {
+			shouldRetry, _ := retryer.ShouldRetry(context.Background(), &http.Response{StatusCode: status}, 1, nil)
+			if shouldRetry {
+				granted++
+			}
+		}
+		return granted
+	}
+
+	assert.Equal(t, 5, respond(500, 10), "the full bucket")
+
+	respond(200, 5)
+	assert.Equal(t, 5, respond(500, 10), "the refilled bucket")
+
+	respond(200, 5)
+	respond(429, 3) // the burst leaves less than a token
+	assert.Equal(t, 0, respond(500, 10), "after the burst of 429")
+
+	respond(200, 2)
+	assert.Equal(t, 2, respond(500, 10), "recovering additively")
+}
+
+func TestScheduleRetryer(t *testing.T) {
+	var attempts int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		attempts++
+		rw.WriteHeader(500)
+	}))
+	defer server.Close()
+
+	var waits []time.Duration
+	fakeClock := func(d time.Duration) <-chan time.Time {
+		waits = append(waits, d)
+		fired := make(chan time.Time, 1)
+		fired <- time.Time{}
+		return fired
+	}
+
+	schedule := []time.Duration{time.Second, 5 * time.Second, time.Minute}
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config:     &Config{BaseURL: server.URL, Retryer: NewScheduleRetryer(schedule)},
+		after:      fakeClock,
+	}
+
+	err := client.Call("any.method", struct{}{}, &struct{}{})
+
+	assert.Error(t, err)
+	assert.Equal(t, len(schedule)+1, attempts)
+	assert.Equal(t, schedule, waits)
+}
+
+func TestScheduleRetryer_Backoff(t *testing.T) {
+	retryer := NewScheduleRetryer([]time.Duration{time.Second, 2 * time.Second})
+
+	assert.Equal(t, time.Second, retryer.Backoff(1, nil))
+	assert.Equal(t, 2*time.Second, retryer.Backoff(2, nil))
+	assert.Equal(t, 2*time.Second, retryer.Backoff(5, nil), "clamped to the last delay")
+	assert.Equal(t, time.Duration(0), NewScheduleRetryer(nil).Backoff(1, nil))
+}
+
+func TestConstantRequestRetryer_Backoff(t *testing.T) {
+	retryer := NewConstantRequestRetryer(3, 100*time.Millisecond)
+
+	assert.Equal(t, 100*time.Millisecond, retryer.Backoff(1, &http.Response{StatusCode: http.StatusServiceUnavailable}))
+	assert.Equal(t, 3*time.Second, retryer.Backoff(1, &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Header:     http.Header{"Retry-After": {"3"}},
+	}))
+	assert.Equal(t, 100*time.Millisecond, retryer.Backoff(2, nil))
+}
+
+func TestPreviewBackoff(t *testing.T) {
+	retryer := NewConstantRequestRetryer(3, 100*time.Millisecond)
+
+	delay := 100 * time.Millisecond
+	assert.Equal(t, []time.Duration{delay, delay, delay}, PreviewBackoff(retryer, 3, nil))
+	assert.Empty(t, PreviewBackoff(retryer, 0, nil))
+}
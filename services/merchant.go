@@ -0,0 +1,38 @@
+package services
+
+import (
+	"context"
+
+	client "github.com/bakurin/payyo-sdk-go-client"
+)
+
+// MerchantDetails is the result of merchant.GetDetails method
+type MerchantDetails struct {
+	MerchantID int    `json:"merchant_id"`
+	Name       string `json:"name"`
+}
+
+type merchantRequest struct {
+	MerchantID int `json:"merchant_id"`
+}
+
+// MerchantService provides typed access to merchant methods of the API
+type MerchantService struct {
+	client client.Client
+}
+
+// NewMerchantService creates a merchant service on top of the client
+func NewMerchantService(c client.Client) *MerchantService {
+	return &MerchantService{client: c}
+}
+
+// GetDetails returns details of the merchant
+func (s *MerchantService) GetDetails(ctx context.Context, id int) (*MerchantDetails, error) {
+	details := &MerchantDetails{}
+	err := s.client.CallWithContext(ctx, "merchant.GetDetails", merchantRequest{MerchantID: id}, details)
+	if err != nil {
+		return nil, err
+	}
+
+	return details, nil
+}
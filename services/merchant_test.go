@@ -0,0 +1,52 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	client "github.com/bakurin/payyo-sdk-go-client"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) client.Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	cfg := client.NewConfig("key", "secret")
+	cfg.BaseURL = server.URL
+
+	return client.New(cfg)
+}
+
+func TestMerchantService_GetDetails(t *testing.T) {
+	c := newTestClient(t, func(rw http.ResponseWriter, req *http.Request) {
+		body := struct {
+			Method string          `json:"method"`
+			Params merchantRequest `json:"params"`
+		}{}
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+		assert.Equal(t, "merchant.GetDetails", body.Method)
+		assert.Equal(t, 1, body.Params.MerchantID)
+
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {"merchant_id": 1, "name": "City Tours"},"id": "1"}`))
+	})
+
+	details, err := NewMerchantService(c).GetDetails(context.Background(), 1)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &MerchantDetails{MerchantID: 1, Name: "City Tours"}, details)
+}
+
+func TestMerchantService_GetDetails_Error(t *testing.T) {
+	c := newTestClient(t, func(rw http.ResponseWriter, req *http.Request) {
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","error": {"code": 404, "message": "merchant not found"},"id": "1"}`))
+	})
+
+	details, err := NewMerchantService(c).GetDetails(context.Background(), 1)
+
+	assert.EqualError(t, err, "merchant not found (404)")
+	assert.Nil(t, details)
+}
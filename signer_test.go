@@ -0,0 +1,106 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// signingService holds the secret the client never sees
+func signingService(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, err := ioutil.ReadAll(req.Body)
+		assert.NoError(t, err)
+
+		signature, err := Hmac256Signer(req.URL.Query().Get("key"), "hsm secret", body)
+		assert.NoError(t, err)
+		_, _ = rw.Write([]byte(signature))
+	}))
+}
+
+func externalSigner(service *httptest.Server) ContextSigner {
+	return func(ctx context.Context, publicKey string, body []byte) (string, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, service.URL+"?key="+publicKey, bytes.NewReader(body))
+		if err != nil {
+			return "", err
+		}
+
+		resp, err := service.Client().Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+
+		signature, err := ioutil.ReadAll(resp.Body)
+		return string(signature), err
+	}
+}
+
+func TestWithContextSigner(t *testing.T) {
+	service := signingService(t)
+	defer service.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, err := ioutil.ReadAll(req.Body)
+		assert.NoError(t, err)
+
+		valid, err := VerifySignature("public", "hsm secret", body, req.Header.Get("Authorization"))
+		assert.NoError(t, err)
+		assert.True(t, valid, "the request is signed by the external service")
+
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {},"id": "1"}`))
+	}))
+	defer server.Close()
+
+	config := NewConfig("public", "")
+	config.BaseURL = server.URL
+	client := New(config, WithContextSigner(externalSigner(service)))
+
+	assert.NoError(t, client.Call("any.method", struct{}{}, &struct{}{}))
+}
+
+func TestWithContextSigner_Error(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	}))
+	defer server.Close()
+
+	config := NewConfig("public", "")
+	config.BaseURL = server.URL
+	config.RetryMax = 3
+	client := New(config, WithContextSigner(func(ctx context.Context, publicKey string, body []byte) (string, error) {
+		return "", errors.New("key is disabled")
+	}))
+
+	err := client.Call("any.method", struct{}{}, &struct{}{})
+
+	assert.EqualError(t, err, "unable to sign request: key is disabled")
+	assert.Equal(t, int32(0), atomic.LoadInt32(&requests), "nothing is sent")
+}
+
+func TestWithContextSigner_Canceled(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	config := NewConfig("public", "")
+	client := New(config, WithContextSigner(func(ctx context.Context, publicKey string, body []byte) (string, error) {
+		<-release // ignores the context
+		return "signature", nil
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err := client.CallWithContext(ctx, "any.method", struct{}{}, &struct{}{})
+
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "unexpected error: %v", err)
+}
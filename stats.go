@@ -0,0 +1,96 @@
+package client
+
+import (
+	"net/http"
+	"sync"
+)
+
+// CircuitState describes the state of the circuit breaker
+type CircuitState string
+
+// Circuit breaker states
+const (
+	CircuitDisabled CircuitState = "disabled"
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half-open" // The cooldown has passed, the next attempt decides
+)
+
+// Stats is the snapshot of the client's view of the server health
+type Stats struct {
+	ConsecutiveFailures int // Failed attempts in a row made by all calls
+	LastStatus          int // HTTP status of the last attempt, zero if it failed without response
+	CircuitState        CircuitState
+	InFlight            int // Number of calls in progress
+}
+
+// StatsReporter is implemented by clients reporting their view of the server health
+type StatsReporter interface {
+	Stats() Stats
+}
+
+var _ StatsReporter = apiClient{}
+
+// Stats returns the current view of the server health, e.g. for ops dashboards
+func (c apiClient) Stats() Stats {
+	stats := Stats{CircuitState: CircuitDisabled}
+	if c.stats != nil {
+		stats = c.stats.snapshot()
+	}
+
+	if c.breaker != nil {
+		stats.CircuitState = c.breaker.state()
+	}
+
+	return stats
+}
+
+// healthStats keeps track of attempt outcomes of all calls of the client
+type healthStats struct {
+	mu                  sync.Mutex
+	consecutiveFailures int
+	lastStatus          int
+	inFlight            int
+}
+
+// record counts the attempt outcome the same way the circuit breaker does
+func (s *healthStats) record(resp *http.Response, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastStatus = 0
+	if resp != nil {
+		s.lastStatus = resp.StatusCode
+	}
+
+	if err == nil && resp.StatusCode < 500 {
+		s.consecutiveFailures = 0
+		return
+	}
+
+	s.consecutiveFailures++
+}
+
+// begin counts the call in flight and returns the function to call once it's completed
+func (s *healthStats) begin() func() {
+	s.mu.Lock()
+	s.inFlight++
+	s.mu.Unlock()
+
+	return func() {
+		s.mu.Lock()
+		s.inFlight--
+		s.mu.Unlock()
+	}
+}
+
+func (s *healthStats) snapshot() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return Stats{
+		ConsecutiveFailures: s.consecutiveFailures,
+		LastStatus:          s.lastStatus,
+		InFlight:            s.inFlight,
+	}
+}
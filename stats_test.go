@@ -0,0 +1,53 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_Stats(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		<-release
+		rw.WriteHeader(500)
+	}))
+	defer server.Close()
+
+	config := NewConfig("public", "secret")
+	config.BaseURL = server.URL
+	config.BackoffStrategy = "none"
+	config.RetryMax = 2
+	config.CircuitBreakerThreshold = 3
+	client := New(config).(StatsReporter)
+
+	assert.Equal(t, Stats{CircuitState: CircuitClosed}, client.Stats())
+
+	done := make(chan error)
+	go func() {
+		done <- client.(Client).Call("any.method", struct{}{}, &struct{}{})
+	}()
+
+	assert.Eventually(t, func() bool {
+		return client.Stats().InFlight == 1
+	}, time.Second, time.Millisecond)
+
+	close(release)
+	assert.Error(t, <-done)
+
+	assert.Equal(t, Stats{
+		ConsecutiveFailures: 3,
+		LastStatus:          500,
+		CircuitState:        CircuitOpen,
+		InFlight:            0,
+	}, client.Stats())
+}
+
+func TestClient_StatsWithoutBreaker(t *testing.T) {
+	client := apiClient{Config: &Config{}}
+
+	assert.Equal(t, Stats{CircuitState: CircuitDisabled}, client.Stats())
+}
@@ -0,0 +1,98 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// StreamError is returned when the streamed result breaks in the middle,
+// items delivered to the callback before the failure stay processed
+type StreamError struct {
+	ItemsProcessed int
+	Err            error
+}
+
+func (e *StreamError) Error() string {
+	return fmt.Sprintf("stream failed after %d item(s): %v", e.ItemsProcessed, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *StreamError) Unwrap() error {
+	return e.Err
+}
+
+// CallStream calls the RPC method which returns an array and passes the items to the callback
+// one by one as they are decoded, so the whole result doesn't have to be kept in memory
+func (c apiClient) CallStream(ctx context.Context, method string, params interface{}, fn func(item json.RawMessage) error) error {
+	return c.call(ctx, Request{Method: method, Params: params}, &rpcCall{stream: fn})
+}
+
+// decodeStream walks the response envelope and streams items of the result array
+func (c apiClient) decodeStream(body io.Reader, call *rpcCall) error {
+	dec := json.NewDecoder(body)
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+
+	var processed int
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return &StreamError{ItemsProcessed: processed, Err: err}
+		}
+
+		switch token {
+		case "result":
+			if err = expectDelim(dec, '['); err != nil {
+				return &StreamError{ItemsProcessed: processed, Err: err}
+			}
+
+			for dec.More() {
+				var item json.RawMessage
+				if err = dec.Decode(&item); err != nil {
+					return &StreamError{ItemsProcessed: processed, Err: err}
+				}
+
+				if err = call.stream(item); err != nil {
+					return &StreamError{ItemsProcessed: processed, Err: err}
+				}
+				processed++
+			}
+
+			if err = expectDelim(dec, ']'); err != nil {
+				return &StreamError{ItemsProcessed: processed, Err: err}
+			}
+		case "error":
+			var rpcErr *RPCError
+			if err = dec.Decode(&rpcErr); err != nil {
+				return err
+			}
+
+			if rpcErr != nil {
+				return rpcErr
+			}
+		default:
+			var skip json.RawMessage
+			if err = dec.Decode(&skip); err != nil {
+				return &StreamError{ItemsProcessed: processed, Err: err}
+			}
+		}
+	}
+
+	return nil
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	if token != delim {
+		return fmt.Errorf("unexpected token %v, expected %v", token, delim)
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_CallStream(t *testing.T) {
+	server := testServer(`{"jsonrpc": "2.0","result": [{"id": 1}, {"id": 2}, {"id": 3}],"id": "1"}`)
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL: server.URL,
+		},
+	}
+
+	var ids []int
+	err := client.CallStream(context.Background(), "any.method", struct{}{}, func(item json.RawMessage) error {
+		v := struct {
+			ID int `json:"id"`
+		}{}
+		if err := json.Unmarshal(item, &v); err != nil {
+			return err
+		}
+		ids = append(ids, v.ID)
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 3}, ids)
+}
+
+func TestClient_CallStream_Truncated(t *testing.T) {
+	server := testServer(`{"jsonrpc": "2.0","result": [{"id": 1}, {"id": 2}, {"id": `)
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL: server.URL,
+		},
+	}
+
+	var delivered int
+	err := client.CallStream(context.Background(), "any.method", struct{}{}, func(item json.RawMessage) error {
+		delivered++
+		return nil
+	})
+
+	var streamErr *StreamError
+	assert.True(t, errors.As(err, &streamErr))
+	assert.Equal(t, 2, delivered)
+	assert.Equal(t, delivered, streamErr.ItemsProcessed)
+}
+
+func TestClient_CallStream_Error(t *testing.T) {
+	server := testServer(`{"jsonrpc": "2.0","error": {"code": 1, "message": "test error"},"id": "1"}`)
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL: server.URL,
+		},
+	}
+
+	err := client.CallStream(context.Background(), "any.method", struct{}{}, func(item json.RawMessage) error {
+		return nil
+	})
+
+	assert.EqualError(t, err, "test error (1)")
+}
@@ -0,0 +1,77 @@
+package client
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Stubber is implemented by clients able to serve canned results, e.g. for local development without the backend
+type Stubber interface {
+	// Stub makes the calls of the method return the result without sending any request
+	Stub(method string, result interface{})
+}
+
+var _ Stubber = apiClient{}
+
+// stubRegistry holds the canned results by method
+type stubRegistry struct {
+	mu      sync.RWMutex
+	results map[string]interface{}
+}
+
+func (r *stubRegistry) set(method string, result interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.results == nil {
+		r.results = make(map[string]interface{})
+	}
+	r.results[method] = result
+}
+
+func (r *stubRegistry) get(method string) (interface{}, bool) {
+	if r == nil {
+		return nil, false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result, ok := r.results[method]
+	return result, ok
+}
+
+// Stub makes the calls of the method return the result without sending any request. The result is encoded
+// by the codec and decoded into the result of the call, so it may be given as a map too
+func (c apiClient) Stub(method string, result interface{}) {
+	c.stubs.set(c.qualifiedMethod(method), result)
+}
+
+// serveStub decodes the canned result of the method into the call, it returns false if the method is not stubbed
+func (c apiClient) serveStub(method string, call *rpcCall) (bool, error) {
+	stub, ok := c.stubs.get(method)
+	if !ok {
+		return false, nil
+	}
+
+	encoded, err := c.codec().Marshal(stub)
+	if err != nil {
+		return true, err
+	}
+
+	if call.stream == nil {
+		return true, c.codec().Unmarshal(encoded, call.result)
+	}
+
+	var items []json.RawMessage
+	if err = json.Unmarshal(encoded, &items); err != nil {
+		return true, err
+	}
+	for _, item := range items {
+		if err = call.stream(item); err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
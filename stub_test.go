@@ -0,0 +1,53 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_Stub(t *testing.T) {
+	var requests int
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requests++
+		return nil, errors.New("no backend")
+	})
+
+	config := NewConfig("public", "secret")
+	config.RetryMax = 0
+	client := New(config, WithTransport(transport))
+	client.(Stubber).Stub("merchant.GetDetails", map[string]interface{}{"merchant_id": 42, "name": "Shop"})
+
+	var details struct {
+		MerchantID int    `json:"merchant_id"`
+		Name       string `json:"name"`
+	}
+	err := client.CallWithContext(context.Background(), "merchant.GetDetails", struct{}{}, &details)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 42, details.MerchantID)
+	assert.Equal(t, "Shop", details.Name)
+	assert.Equal(t, 0, requests)
+
+	// the methods not stubbed are still sent
+	assert.Error(t, client.Call("merchant.Update", struct{}{}, &struct{}{}))
+	assert.Equal(t, 1, requests)
+}
+
+func TestClient_Stub_Stream(t *testing.T) {
+	client := New(NewConfig("public", "secret"))
+	client.(Stubber).Stub("payment.List", []string{"p-1", "p-2"})
+
+	var items []string
+	err := client.CallStream(context.Background(), "payment.List", struct{}{}, func(item json.RawMessage) error {
+		items = append(items, string(item))
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`"p-1"`, `"p-2"`}, items)
+}
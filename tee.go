@@ -0,0 +1,45 @@
+package client
+
+import (
+	"context"
+	"io"
+)
+
+// bodyTee holds the writers set by WithBodyTee
+type bodyTee struct {
+	request  io.Writer
+	response io.Writer
+}
+
+// WithBodyTee copies the exact request and response bodies of the calls to the writers, e.g. to record
+// fixtures from a live environment. Either writer may be nil. The request body is written once per call
+// in a single write, while the response body is written as it's read, so the writers are not meant
+// to be shared by concurrent calls
+func WithBodyTee(requestWriter, responseWriter io.Writer) Option {
+	return func(c *apiClient) {
+		c.tee = &bodyTee{request: requestWriter, response: responseWriter}
+	}
+}
+
+// teeRequest writes the request body, the failure is logged as the call is not affected
+func (c apiClient) teeRequest(ctx context.Context, body []byte) {
+	if c.tee == nil || c.tee.request == nil {
+		return
+	}
+
+	if _, err := c.tee.request.Write(body); err != nil {
+		c.log(ctx, ErrorLevel, "unable to tee request body: %v", err)
+	}
+}
+
+// teeResponse makes the body copy everything read from it to the response writer
+func (c apiClient) teeResponse(body io.ReadCloser) io.ReadCloser {
+	if c.tee == nil || c.tee.response == nil {
+		return body
+	}
+
+	return &replayBody{
+		Reader: io.TeeReader(body, c.tee.response),
+		Closer: body,
+	}
+}
@@ -0,0 +1,35 @@
+package client
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithBodyTee(t *testing.T) {
+	const response = "{\"jsonrpc\": \"2.0\",\n \"result\": {\"key\": \"Value\"},\n \"id\": \"1\"}\n"
+	var sent []byte
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		sent, _ = ioutil.ReadAll(req.Body)
+		_, _ = rw.Write([]byte(response))
+	}))
+	defer server.Close()
+
+	var requests, responses bytes.Buffer
+	config := NewConfig("public", "secret")
+	config.BaseURL = server.URL
+	client := New(config, WithBodyTee(&requests, &responses))
+
+	result := &struct {
+		Key string `json:"key"`
+	}{}
+	assert.NoError(t, client.Call("any.method", map[string]int{"merchant_id": 42}, result))
+
+	assert.Equal(t, "Value", result.Key)
+	assert.Equal(t, string(sent), requests.String())
+	assert.Equal(t, response, responses.String())
+}
@@ -0,0 +1,43 @@
+package client
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// FieldError describes the invalid param
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists the invalid params the API has rejected the call because of
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	fields := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		fields = append(fields, field.Field+": "+field.Message)
+	}
+
+	return "validation failed: " + strings.Join(fields, ", ")
+}
+
+// ValidationError decodes the field errors given in the data of the error,
+// it returns false if the data is not the array of field errors
+func (e *RPCError) ValidationError() (*ValidationError, bool) {
+	var fields []FieldError
+	if len(e.Data) == 0 || json.Unmarshal(e.Data, &fields) != nil || len(fields) == 0 {
+		return nil, false
+	}
+
+	for _, field := range fields {
+		if field.Field == "" {
+			return nil, false
+		}
+	}
+
+	return &ValidationError{Fields: fields}, true
+}
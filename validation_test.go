@@ -0,0 +1,34 @@
+package client
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRPCError_ValidationError(t *testing.T) {
+	server := testServer(`{"jsonrpc": "2.0", "id": "1", "error": {"code": -32602, "message": "Invalid params",
+		"data": [{"field": "amount", "message": "must be positive"}, {"field": "currency", "message": "is required"}]}}`)
+	defer server.Close()
+	client := apiClient{HTTPClient: server.Client(), Config: &Config{BaseURL: server.URL}}
+
+	err := client.Call("transaction.initialize", struct{}{}, &struct{}{})
+
+	var rpcErr *RPCError
+	assert.True(t, errors.As(err, &rpcErr))
+	validationErr, ok := rpcErr.ValidationError()
+	assert.True(t, ok)
+	assert.Equal(t, []FieldError{
+		{Field: "amount", Message: "must be positive"},
+		{Field: "currency", Message: "is required"},
+	}, validationErr.Fields)
+	assert.EqualError(t, validationErr, "validation failed: amount: must be positive, currency: is required")
+}
+
+func TestRPCError_ValidationError_OtherData(t *testing.T) {
+	for _, data := range []string{``, `{"field": "amount"}`, `[]`, `["amount"]`, `[{"message": "no field"}]`} {
+		_, ok := (&RPCError{Code: -32602, Data: []byte(data)}).ValidationError()
+		assert.False(t, ok, data)
+	}
+}
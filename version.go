@@ -0,0 +1,66 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// APIVersion is the version of the API to call
+type APIVersion string
+
+// Supported API versions
+const (
+	V3 APIVersion = "v3"
+	V4 APIVersion = "v4"
+)
+
+var versionSuffix = regexp.MustCompile(`/v\d+/?$`)
+
+// versionedURL replaces the version the base URL ends with by the requested one
+func versionedURL(baseURL string, version APIVersion) string {
+	if version == "" {
+		return baseURL
+	}
+
+	return versionSuffix.ReplaceAllString(strings.TrimSuffix(baseURL, "/"), "") + "/" + string(version)
+}
+
+// setVersionHeader tells the server which version the call is pinned to
+func setVersionHeader(req *http.Request, version APIVersion) {
+	if version != "" {
+		req.Header.Set("X-API-Version", string(version))
+	}
+}
+
+// DefaultVersionHeader is the response header the server reports the API version in
+const DefaultVersionHeader = "X-API-Version"
+
+// urlVersion returns the version the URL path ends with, empty if there is none
+func urlVersion(path string) APIVersion {
+	return APIVersion(strings.Trim(versionSuffix.FindString(path), "/"))
+}
+
+// warnVersionMismatch logs the response served by another API version than the one the request was sent to,
+// which is most likely a routing or config bug
+func (c apiClient) warnVersionMismatch(ctx context.Context, method string, req *http.Request, resp *http.Response) {
+	header := c.Config.VersionHeader
+	if header == "" {
+		header = DefaultVersionHeader
+	}
+
+	// the version precedes the method appended to the path by EncodeMethodInPath
+	path := req.URL.Path
+	if c.Config.EncodeMethodInPath {
+		path = strings.TrimSuffix(path, "/"+method)
+	}
+
+	served := APIVersion(strings.TrimSpace(resp.Header.Get(header)))
+	expected := urlVersion(path)
+	if served == "" || expected == "" || strings.EqualFold(string(served), string(expected)) {
+		return
+	}
+
+	c.log(ctx, WarningLevel, "%s is served by API version %s instead of %s", method, served, expected)
+}
@@ -0,0 +1,78 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersionedURL(t *testing.T) {
+	assert.Equal(t, BaseURLV3, versionedURL(BaseURLV3, ""))
+	assert.Equal(t, BaseURLV4, versionedURL(BaseURLV3, V4))
+	assert.Equal(t, BaseURLV3, versionedURL(BaseURLV4+"/", V3))
+	assert.Equal(t, "http://localhost:8080/v4", versionedURL("http://localhost:8080", V4))
+}
+
+func TestClient_CallRequest_Version(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("X-API-Version") == "" {
+			assert.Equal(t, "/v3", req.URL.Path)
+		} else {
+			assert.Equal(t, "/v4", req.URL.Path)
+			assert.Equal(t, "v4", req.Header.Get("X-API-Version"))
+		}
+
+		_, _ = rw.Write([]byte("{}"))
+	}))
+
+	client := apiClient{
+		HTTPClient: server.Client(),
+		Config: &Config{
+			BaseURL: server.URL + "/v3",
+		},
+	}
+
+	err := client.CallRequest(context.Background(), Request{Method: "any.method", Version: V4}, &struct{}{})
+	assert.NoError(t, err)
+
+	err = client.Call("any.method", struct{}{}, &struct{}{})
+	assert.NoError(t, err)
+}
+
+func TestClient_Call_VersionMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("X-Served-Version", "v4")
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": {},"id": "1"}`))
+	}))
+	defer server.Close()
+
+	for _, methodInPath := range []bool{false, true} {
+		t.Run(fmt.Sprintf("methodInPath=%t", methodInPath), func(t *testing.T) {
+			var warnings []string
+			client := apiClient{
+				HTTPClient: server.Client(),
+				Config: &Config{
+					BaseURL:            server.URL + "/v3",
+					VersionHeader:      "X-Served-Version",
+					EncodeMethodInPath: methodInPath,
+					Logger: LoggerFunc(func(level LogLevel, format string, args ...interface{}) {
+						if level == WarningLevel {
+							warnings = append(warnings, fmt.Sprintf(format, args...))
+						}
+					}),
+				},
+			}
+
+			assert.NoError(t, client.Call("any.method", struct{}{}, &struct{}{}))
+			assert.Equal(t, []string{"any.method is served by API version v4 instead of v3"}, warnings)
+
+			warnings = nil
+			assert.NoError(t, client.CallRequest(context.Background(), Request{Method: "any.method", Version: V4}, &struct{}{}))
+			assert.Empty(t, warnings)
+		})
+	}
+}
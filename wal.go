@@ -0,0 +1,123 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// WALEntry is the request kept in the write-ahead log until it's delivered
+type WALEntry struct {
+	ID     string // Assigned by WAL.Append
+	Method string
+	Params json.RawMessage
+}
+
+// WAL is the durable storage of the requests which have not been delivered yet, e.g. a file or a database table
+type WAL interface {
+	// Append persists the entry and returns its id
+	Append(ctx context.Context, entry WALEntry) (string, error)
+	// Remove deletes the delivered entry
+	Remove(ctx context.Context, id string) error
+	// Pending returns the entries not removed yet in the order they were appended
+	Pending(ctx context.Context) ([]WALEntry, error)
+}
+
+// DurableQueue delivers requests, e.g. critical notifications, at least once. The request is appended
+// to the WAL before it's sent and removed once it's succeeded, so the failed one can be replayed later,
+// e.g. on startup. The results of the calls are discarded. The entries being sent are skipped by Replay,
+// so concurrent Send and Replay of the queue don't deliver the same entry twice. The queues of several
+// processes sharing the WAL may still do it
+type DurableQueue struct {
+	client Client
+	wal    WAL
+	codec  Codec
+
+	mu       sync.Mutex
+	inFlight map[string]struct{}
+}
+
+// NewDurableQueue creates the queue sending the requests with the client, the params are encoded
+// with Config.Codec of the client created by New
+func NewDurableQueue(client Client, wal WAL) *DurableQueue {
+	var codec Codec = defaultCodec
+	if c, ok := client.(interface{ codec() Codec }); ok {
+		codec = c.codec()
+	}
+
+	return &DurableQueue{client: client, wal: wal, codec: codec, inFlight: map[string]struct{}{}}
+}
+
+// Send persists the request and sends it. The request stays in the WAL to be replayed if it fails
+func (q *DurableQueue) Send(ctx context.Context, method string, params interface{}) error {
+	encoded, err := q.codec.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	entry := WALEntry{Method: method, Params: encoded}
+	if entry.ID, err = q.wal.Append(ctx, entry); err != nil {
+		return fmt.Errorf("unable to append %s to WAL: %w", method, err)
+	}
+
+	q.claim(entry.ID)
+	defer q.release(entry.ID)
+
+	return q.deliver(ctx, entry)
+}
+
+// Replay sends the pending requests in order and stops at the first one failed, so the order is kept
+func (q *DurableQueue) Replay(ctx context.Context) error {
+	entries, err := q.wal.Pending(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to read WAL: %w", err)
+	}
+
+	for _, entry := range entries {
+		if !q.claim(entry.ID) {
+			continue // it's being sent by the concurrent call
+		}
+		err = q.deliver(ctx, entry)
+		q.release(entry.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// claim marks the entry as being sent, it tells false if the entry is already being sent
+func (q *DurableQueue) claim(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.inFlight[id]; ok {
+		return false
+	}
+	q.inFlight[id] = struct{}{}
+
+	return true
+}
+
+func (q *DurableQueue) release(id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.inFlight, id)
+}
+
+// deliver sends the persisted request and removes it once it's succeeded
+func (q *DurableQueue) deliver(ctx context.Context, entry WALEntry) error {
+	var result json.RawMessage
+	if err := q.client.CallRequest(ctx, Request{Method: entry.Method, Params: entry.Params}, &result); err != nil {
+		return err
+	}
+
+	if err := q.wal.Remove(ctx, entry.ID); err != nil {
+		return fmt.Errorf("unable to remove %s from WAL: %w", entry.ID, err)
+	}
+
+	return nil
+}
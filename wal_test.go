@@ -0,0 +1,141 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryWAL keeps the entries in memory
+type memoryWAL struct {
+	mu      sync.Mutex
+	seq     int
+	entries []WALEntry
+}
+
+func (w *memoryWAL) Append(ctx context.Context, entry WALEntry) (string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.seq++
+	entry.ID = strconv.Itoa(w.seq)
+	w.entries = append(w.entries, entry)
+
+	return entry.ID, nil
+}
+
+func (w *memoryWAL) Remove(ctx context.Context, id string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for i, entry := range w.entries {
+		if entry.ID == id {
+			w.entries = append(w.entries[:i], w.entries[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+func (w *memoryWAL) Pending(ctx context.Context) ([]WALEntry, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return append([]WALEntry(nil), w.entries...), nil
+}
+
+func TestDurableQueue_Replay(t *testing.T) {
+	var down int32 = 1
+	var delivered []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if atomic.LoadInt32(&down) == 1 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(req.Body)
+		delivered = append(delivered, string(body))
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": null,"id": "1"}`))
+	}))
+	defer server.Close()
+
+	client := apiClient{HTTPClient: server.Client(), Config: &Config{BaseURL: server.URL}}
+	wal := &memoryWAL{}
+	queue := NewDurableQueue(client, wal)
+
+	err := queue.Send(context.Background(), "payment.notify", map[string]string{"payment_id": "p-1"})
+	assert.Error(t, err)
+
+	pending, err := wal.Pending(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, "payment.notify", pending[0].Method)
+
+	// the restarted process replays the notification once the server is back
+	atomic.StoreInt32(&down, 0)
+	assert.NoError(t, NewDurableQueue(client, wal).Replay(context.Background()))
+
+	assert.Equal(t, []string{`{"jsonrpc":"2.0","method":"payment.notify","id":"1","params":{"payment_id":"p-1"}}`}, delivered)
+	pending, err = wal.Pending(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestDurableQueue_Send_Codec(t *testing.T) {
+	server := testServer(`{"jsonrpc": "2.0","result": null,"id": "1"}`)
+	defer server.Close()
+
+	wal := &failingRemoveWAL{}
+	client := New(&Config{BaseURL: server.URL, Codec: SnakeCaseCodec{}})
+	err := NewDurableQueue(client, wal).Send(context.Background(), "payment.notify", struct{ PaymentID string }{"p-1"})
+
+	assert.Error(t, err)
+	assert.JSONEq(t, `{"payment_id":"p-1"}`, string(wal.entries[0].Params), "the params are encoded with the codec of the client")
+}
+
+// failingRemoveWAL keeps the entries even if they have been delivered
+type failingRemoveWAL struct {
+	memoryWAL
+}
+
+func (w *failingRemoveWAL) Remove(ctx context.Context, id string) error {
+	return errors.New("remove failed")
+}
+
+func TestDurableQueue_ConcurrentSendAndReplay(t *testing.T) {
+	var requests int32
+	received := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			close(received)
+			<-release
+		}
+		_, _ = rw.Write([]byte(`{"jsonrpc": "2.0","result": null,"id": "1"}`))
+	}))
+	defer server.Close()
+
+	client := apiClient{HTTPClient: server.Client(), Config: &Config{BaseURL: server.URL}}
+	queue := NewDurableQueue(client, &memoryWAL{})
+
+	sent := make(chan error, 1)
+	go func() {
+		sent <- queue.Send(context.Background(), "payment.notify", map[string]string{"payment_id": "p-1"})
+	}()
+
+	<-received
+	assert.NoError(t, queue.Replay(context.Background()), "the entry being sent is skipped")
+	close(release)
+
+	assert.NoError(t, <-sent)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
@@ -0,0 +1,398 @@
+// Package wsrpc implements the API client over a persistent WebSocket connection.
+// It lives apart from the core package to keep the WebSocket dependency optional.
+package wsrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	client "github.com/bakurin/payyo-sdk-go-client"
+	"github.com/gorilla/websocket"
+)
+
+// ErrClosed is returned by calls made after the client is closed
+var ErrClosed = errors.New("websocket client is closed")
+
+// Config configures the WebSocket client
+type Config struct {
+	URL       string
+	PublicKey string
+	Secret    string
+	Codec     client.Codec      // Params and result codec, client.JSONCodec if nil
+	Dialer    *websocket.Dialer // websocket.DefaultDialer if nil
+
+	// KeepAliveInterval enables pings sent over the idle connection to keep intermediaries from reaping it.
+	// The connection is torn down if the server does not answer within two intervals and the next call reconnects
+	KeepAliveInterval time.Duration
+
+	// Authorize sets the credentials of the handshake request, SignedURLAuthorization if nil
+	Authorize func(ctx context.Context, config Config, header http.Header) error
+}
+
+// SignedURLAuthorization sets Authorization header to the signature of the endpoint URL made by client.Hmac256Signer,
+// as if the URL was the request body. It's the convention of this package rather than a documented scheme of
+// the API, so the servers expecting other handshake credentials need Config.Authorize
+func SignedURLAuthorization(ctx context.Context, config Config, header http.Header) error {
+	authorization, err := client.AuthorizationHeader(client.DefaultAuthScheme, client.Hmac256Signer,
+		config.PublicKey, config.Secret, []byte(config.URL))
+	if err != nil {
+		return err
+	}
+
+	header.Set("Authorization", authorization)
+	return nil
+}
+
+// Client calls the API over a single WebSocket connection. Concurrent calls are multiplexed
+// matching responses by request ids. The connection is re-established by the next call once it drops
+type Client struct {
+	config  Config
+	counter uint64
+
+	mu      sync.Mutex // guards conn, dialing, pending and closed
+	conn    *websocket.Conn
+	dialing *dialCall // set while the connection is being established
+	pending map[string]chan *response
+	closed  bool
+
+	writeMu sync.Mutex // serializes writes to the connection
+}
+
+var _ client.Client = (*Client)(nil)
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      string          `json:"id"`
+}
+
+type response struct {
+	JSONRPC string           `json:"jsonrpc"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *client.RPCError `json:"error,omitempty"`
+	ID      string           `json:"id"`
+	err     error            // set if the connection dropped before the response arrived
+}
+
+// dialCall is the dial shared by the calls waiting for the connection
+type dialCall struct {
+	done chan struct{}
+	err  error
+}
+
+// New creates the client, the connection is established by the first call
+func New(config Config) *Client {
+	if config.Codec == nil {
+		config.Codec = client.JSONCodec{}
+	}
+	if config.Dialer == nil {
+		config.Dialer = websocket.DefaultDialer
+	}
+	if config.Authorize == nil {
+		config.Authorize = SignedURLAuthorization
+	}
+
+	return &Client{
+		config:  config,
+		pending: map[string]chan *response{},
+	}
+}
+
+// Call the RPC method
+func (c *Client) Call(method string, params, result interface{}) error {
+	return c.CallWithContext(context.Background(), method, params, result)
+}
+
+// CallWithContext is the same as Call but allows to pass a context
+func (c *Client) CallWithContext(ctx context.Context, method string, params, result interface{}) error {
+	return c.CallRequest(ctx, client.Request{Method: method, Params: params}, result)
+}
+
+// CallRequest calls the RPC method described by the request, ids have to be unique among calls in flight
+func (c *Client) CallRequest(ctx context.Context, req client.Request, result interface{}) error {
+	resp, err := c.roundTrip(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	if len(resp.Result) == 0 {
+		return nil
+	}
+
+	return c.config.Codec.Unmarshal(resp.Result, result)
+}
+
+// CallStream calls the RPC method which returns an array and passes its items to the callback one by one
+func (c *Client) CallStream(ctx context.Context, method string, params interface{}, fn func(item json.RawMessage) error) error {
+	resp, err := c.roundTrip(ctx, client.Request{Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+
+	var items []json.RawMessage
+	if err = json.Unmarshal(resp.Result, &items); err != nil {
+		return &client.StreamError{Err: err}
+	}
+
+	for i, item := range items {
+		if err = fn(item); err != nil {
+			return &client.StreamError{ItemsProcessed: i, Err: err}
+		}
+	}
+
+	return nil
+}
+
+// Close closes the connection and fails the calls in flight
+func (c *Client) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	conn := c.conn
+	c.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+
+	return conn.Close()
+}
+
+func (c *Client) roundTrip(ctx context.Context, req client.Request) (*response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	method := strings.TrimSpace(req.Method)
+	if method == "" {
+		return nil, client.ErrEmptyMethod
+	}
+
+	params, ok := req.Params.(json.RawMessage)
+	if !ok {
+		encoded, err := c.config.Codec.Marshal(req.Params)
+		if err != nil {
+			return nil, err
+		}
+		params = encoded
+	}
+
+	id := req.ID
+	if id == "" {
+		id = strconv.FormatUint(atomic.AddUint64(&c.counter, 1), 10)
+	}
+
+	message, err := json.Marshal(request{JSONRPC: "2.0", Method: method, Params: params, ID: id})
+	if err != nil {
+		return nil, err
+	}
+
+	conn, ch, err := c.register(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	defer c.unregister(id)
+
+	c.writeMu.Lock()
+	err = conn.WriteMessage(websocket.TextMessage, message)
+	c.writeMu.Unlock()
+	if err != nil {
+		c.drop(conn, err)
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case resp := <-ch:
+		if resp.err != nil {
+			return nil, resp.err
+		}
+		if resp.Error != nil {
+			return nil, resp.Error
+		}
+		return resp, nil
+	}
+}
+
+// register reserves the id for the call and returns the connection to send the request to. The connection
+// is dialed without holding the lock, the calls made meanwhile wait for the same dial
+func (c *Client) register(ctx context.Context, id string) (*websocket.Conn, chan *response, error) {
+	for {
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			return nil, nil, ErrClosed
+		}
+
+		if _, ok := c.pending[id]; ok {
+			c.mu.Unlock()
+			return nil, nil, fmt.Errorf("request id %q is already in flight", id)
+		}
+
+		if c.conn != nil {
+			ch := make(chan *response, 1)
+			c.pending[id] = ch
+			conn := c.conn
+			c.mu.Unlock()
+
+			return conn, ch, nil
+		}
+
+		dialing := c.dialing
+		if dialing == nil {
+			dialing = &dialCall{done: make(chan struct{})}
+			c.dialing = dialing
+			c.mu.Unlock()
+			c.connect(ctx, dialing)
+		} else {
+			c.mu.Unlock()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-dialing.done:
+		}
+
+		// the dial canceled by the context of another call is made once again
+		if dialing.err != nil && !errors.Is(dialing.err, context.Canceled) && !errors.Is(dialing.err, context.DeadlineExceeded) {
+			return nil, nil, dialing.err
+		}
+	}
+}
+
+// connect dials the connection and starts serving it unless the client has been closed meanwhile
+func (c *Client) connect(ctx context.Context, dialing *dialCall) {
+	conn, err := c.dial(ctx)
+
+	c.mu.Lock()
+	c.dialing = nil
+	switch {
+	case err != nil:
+	case c.closed:
+		_ = conn.Close()
+		err = ErrClosed
+	default:
+		c.conn = conn
+		done := make(chan struct{})
+		go c.readLoop(conn, done)
+		if c.config.KeepAliveInterval > 0 {
+			go c.keepAlive(conn, done)
+		}
+	}
+	c.mu.Unlock()
+
+	dialing.err = err
+	close(dialing.done)
+}
+
+func (c *Client) unregister(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.pending, id)
+}
+
+// dial connects to the server authorizing the handshake with Config.Authorize
+func (c *Client) dial(ctx context.Context) (*websocket.Conn, error) {
+	header := http.Header{}
+	if err := c.config.Authorize(ctx, c.config, header); err != nil {
+		return nil, err
+	}
+
+	conn, resp, err := c.config.Dialer.DialContext(ctx, c.config.URL, header)
+	if resp != nil && resp.Body != nil {
+		_ = resp.Body.Close()
+	}
+
+	return conn, err
+}
+
+// readLoop dispatches responses to the calls waiting for them until the connection drops
+func (c *Client) readLoop(conn *websocket.Conn, done chan struct{}) {
+	defer close(done)
+
+	if c.config.KeepAliveInterval > 0 {
+		c.extendDeadline(conn)
+		conn.SetPongHandler(func(string) error {
+			c.extendDeadline(conn)
+			return nil
+		})
+	}
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			c.drop(conn, err)
+			return
+		}
+
+		if c.config.KeepAliveInterval > 0 {
+			c.extendDeadline(conn)
+		}
+
+		resp := &response{}
+		if err = json.Unmarshal(message, resp); err != nil {
+			continue // not a response to any of the calls
+		}
+
+		c.mu.Lock()
+		ch, ok := c.pending[resp.ID]
+		delete(c.pending, resp.ID)
+		c.mu.Unlock()
+
+		if ok {
+			ch <- resp
+		}
+	}
+}
+
+// keepAlive pings the server until the connection drops
+func (c *Client) keepAlive(conn *websocket.Conn, done chan struct{}) {
+	ticker := time.NewTicker(c.config.KeepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			deadline := time.Now().Add(c.config.KeepAliveInterval)
+			if err := conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				c.drop(conn, err)
+				return
+			}
+		}
+	}
+}
+
+// extendDeadline lets the connection stay idle for two keep-alive intervals before it is considered dead
+func (c *Client) extendDeadline(conn *websocket.Conn) {
+	_ = conn.SetReadDeadline(time.Now().Add(2 * c.config.KeepAliveInterval))
+}
+
+// drop forgets the broken connection and fails the calls waiting for responses from it
+func (c *Client) drop(conn *websocket.Conn, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn != conn {
+		return
+	}
+
+	_ = conn.Close()
+	c.conn = nil
+	for id, ch := range c.pending {
+		ch <- &response{err: fmt.Errorf("connection dropped: %w", err)}
+		delete(c.pending, id)
+	}
+}
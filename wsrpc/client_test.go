@@ -0,0 +1,266 @@
+package wsrpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// echoServer answers each request with its params, closing the connection after closeAfter requests if set
+func echoServer(t *testing.T, closeAfter int) (*httptest.Server, *int32) {
+	var connections int32
+	upgrader := websocket.Upgrader{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "Basic "))
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+
+		atomic.AddInt32(&connections, 1)
+
+		var writeMu sync.Mutex
+		var pending sync.WaitGroup
+		defer pending.Wait()
+		for served := 0; closeAfter == 0 || served < closeAfter; served++ {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			var req request
+			assert.NoError(t, json.Unmarshal(message, &req))
+
+			// answer out of order to exercise id matching
+			pending.Add(1)
+			go func() {
+				defer pending.Done()
+				resp := fmt.Sprintf(`{"jsonrpc":"2.0","result":%s,"id":%q}`, req.Params, req.ID)
+				writeMu.Lock()
+				defer writeMu.Unlock()
+				_ = conn.WriteMessage(websocket.TextMessage, []byte(resp))
+			}()
+		}
+	}))
+
+	return server, &connections
+}
+
+func wsURL(server *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func TestClient_ConcurrentCalls(t *testing.T) {
+	server, connections := echoServer(t, 0)
+	defer server.Close()
+
+	c := New(Config{URL: wsURL(server), PublicKey: "public", Secret: "secret"})
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var result map[string]int
+			err := c.Call("echo", map[string]int{"n": i}, &result)
+			assert.NoError(t, err)
+			assert.Equal(t, i, result["n"])
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(connections), "the calls share the single dial")
+}
+
+func TestClient_Authorize(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+
+		var req request
+		assert.NoError(t, conn.ReadJSON(&req))
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"jsonrpc":"2.0","result":{},"id":%q}`, req.ID)))
+		_, _, _ = conn.ReadMessage()
+	}))
+	defer server.Close()
+
+	c := New(Config{
+		URL: wsURL(server),
+		Authorize: func(ctx context.Context, config Config, header http.Header) error {
+			header.Set("Authorization", "Bearer token")
+			return nil
+		},
+	})
+	defer c.Close()
+
+	assert.NoError(t, c.Call("any.method", nil, &struct{}{}))
+}
+
+func TestClient_CloseWhileDialing(t *testing.T) {
+	dialing := make(chan struct{})
+	release := make(chan struct{})
+	c := New(Config{
+		URL: "ws://127.0.0.1:0",
+		Authorize: func(ctx context.Context, config Config, header http.Header) error {
+			close(dialing)
+			<-release
+			return nil
+		},
+	})
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- c.Call("any.method", nil, nil)
+	}()
+
+	<-dialing
+	closed := make(chan error, 1)
+	go func() {
+		closed <- c.Close()
+	}()
+
+	select {
+	case err := <-closed:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Close is blocked by the dial")
+	}
+
+	close(release)
+	assert.Error(t, <-errs)
+}
+
+func TestClient_RPCError(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+
+		var req request
+		assert.NoError(t, conn.ReadJSON(&req))
+		_ = conn.WriteMessage(websocket.TextMessage,
+			[]byte(fmt.Sprintf(`{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found"},"id":%q}`, req.ID)))
+		_, _, _ = conn.ReadMessage()
+	}))
+	defer server.Close()
+
+	c := New(Config{URL: wsURL(server)})
+	defer c.Close()
+
+	err := c.CallWithContext(context.Background(), "unknown", nil, nil)
+	assert.EqualError(t, err, "Method not found (-32601)")
+}
+
+func TestClient_ReconnectsAfterDrop(t *testing.T) {
+	server, connections := echoServer(t, 1)
+	defer server.Close()
+
+	c := New(Config{URL: wsURL(server)})
+	defer c.Close()
+
+	for i := 0; i < 3; i++ {
+		var result int
+		err := c.Call("echo", i, &result)
+		if err != nil {
+			// the call raced with the server closing the connection, the next one redials
+			err = c.Call("echo", i, &result)
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, i, result)
+	}
+
+	assert.True(t, atomic.LoadInt32(connections) >= 2)
+}
+
+func TestClient_Closed(t *testing.T) {
+	c := New(Config{URL: "ws://127.0.0.1:0"})
+	assert.NoError(t, c.Close())
+	assert.Equal(t, ErrClosed, c.Call("echo", nil, nil))
+}
+
+func TestClient_KeepAlivePings(t *testing.T) {
+	var pings int32
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+
+		conn.SetPingHandler(func(data string) error {
+			atomic.AddInt32(&pings, 1)
+			return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+		})
+
+		for {
+			var req request
+			if err := conn.ReadJSON(&req); err != nil {
+				return
+			}
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"jsonrpc":"2.0","result":true,"id":%q}`, req.ID)))
+		}
+	}))
+	defer server.Close()
+
+	c := New(Config{URL: wsURL(server), KeepAliveInterval: 10 * time.Millisecond})
+	defer c.Close()
+
+	var result bool
+	assert.NoError(t, c.Call("echo", nil, &result))
+	time.Sleep(100 * time.Millisecond)
+	assert.True(t, atomic.LoadInt32(&pings) >= 3)
+
+	// the connection is still alive since the server answers pings
+	assert.NoError(t, c.Call("echo", nil, &result))
+	assert.True(t, result)
+}
+
+func TestClient_KeepAliveDetectsDeadConnection(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+		<-release // never reads, so neither answers pings nor requests
+	}))
+	defer server.Close()
+	defer close(release)
+
+	c := New(Config{URL: wsURL(server), KeepAliveInterval: 10 * time.Millisecond})
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err := c.CallWithContext(ctx, "echo", nil, nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "connection dropped")
+	}
+}
@@ -0,0 +1,9 @@
+module github.com/bakurin/payyo-sdk-go-client/wsrpc
+
+go 1.15
+
+require (
+	github.com/bakurin/payyo-sdk-go-client v0.1.0
+	github.com/gorilla/websocket v1.4.2
+	github.com/stretchr/testify v1.6.1
+)